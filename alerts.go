@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	alertAbove  = "above"
+	alertBelow  = "below"
+	alertChange = "change"
+)
+
+var alertRules []*alertRule
+var alertMutex sync.Mutex
+
+type alertRule struct {
+	Name      string  `json:"name,omitempty"`
+	Series    string  `json:"series"`
+	Dim       string  `json:"dim,omitempty"`
+	Kind      string  `json:"kind"`
+	Threshold float64 `json:"threshold"`
+	Window    int     `json:"window,omitempty"`
+	Command   string  `json:"command,omitempty"`
+	Webhook   string  `json:"webhook,omitempty"`
+
+	firing bool
+	since  time.Time
+	value  float64
+	dim    string
+}
+
+func (r *alertRule) title() string {
+	// use name if available
+	if r.Name != "" {
+		return r.Name
+	}
+
+	return r.Series + " " + r.condition()
+}
+
+func (r *alertRule) condition() string {
+	// format condition
+	switch r.Kind {
+	case alertAbove:
+		return "> " + f2s(r.Threshold)
+	case alertBelow:
+		return "< " + f2s(r.Threshold)
+	default:
+		return fmt.Sprintf("changes by %s over %d samples", f2s(r.Threshold), max(r.Window, 1))
+	}
+}
+
+func (r *alertRule) check(values []float64) (float64, bool) {
+	// check values, only samples that have been added are provided
+	if len(values) == 0 {
+		return 0, false
+	}
+	last := values[len(values)-1]
+
+	// check condition
+	switch r.Kind {
+	case alertAbove:
+		return last, last > r.Threshold
+	case alertBelow:
+		return last, last < r.Threshold
+	case alertChange:
+		window := max(r.Window, 1)
+		if len(values) <= window {
+			return 0, false
+		}
+		change := last - values[len(values)-1-window]
+		return change, math.Abs(change) > r.Threshold
+	default:
+		return 0, false
+	}
+}
+
+func loadAlerts(path string) error {
+	// read file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// decode rules
+	var rules []*alertRule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return err
+	}
+
+	// check rules
+	for _, rule := range rules {
+		if rule.Series == "" {
+			return fmt.Errorf("rule %q: missing series", rule.title())
+		} else if rule.Kind != alertAbove && rule.Kind != alertBelow && rule.Kind != alertChange {
+			return fmt.Errorf("rule %q: invalid kind %q", rule.title(), rule.Kind)
+		}
+	}
+
+	// set rules
+	alertMutex.Lock()
+	alertRules = rules
+	alertMutex.Unlock()
+
+	return nil
+}
+
+func saveAlerts(path string) error {
+	// encode rules
+	alertMutex.Lock()
+	data, err := json.MarshalIndent(alertRules, "", "  ")
+	alertMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func addAlert(rule *alertRule) {
+	// acquire mutex
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	// add rule
+	alertRules = append(alertRules, rule)
+}
+
+func removeAlert(rule *alertRule) {
+	// acquire mutex
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	// remove rule
+	alertRules = lo.Without(alertRules, rule)
+}
+
+func withAlerts(fn func(rules []*alertRule)) {
+	// acquire mutex
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	// yield
+	fn(alertRules)
+}
+
+func firingAlerts() []*alertRule {
+	// acquire mutex
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	return lo.Filter(alertRules, func(rule *alertRule, _ int) bool {
+		return rule.firing
+	})
+}
+
+func alertFiring(series string) bool {
+	// acquire mutex
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	return lo.ContainsBy(alertRules, func(rule *alertRule) bool {
+		return rule.firing && rule.Series == series
+	})
+}
+
+func evaluateAlerts() {
+	// acquire mutexes
+	metricsMutex.RLock()
+	defer metricsMutex.RUnlock()
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	// index series
+	series := map[string]*metricSeries{}
+	metricsTree.walk(func(node *metricsNode) {
+		if node.series != nil {
+			series[node.series.name] = node.series
+		}
+	})
+
+	// evaluate rules
+	for _, rule := range alertRules {
+		// check series
+		s := series[rule.Series]
+		if s == nil {
+			continue
+		}
+
+		// check dimensions
+		var firing bool
+		for _, dim := range s.dims {
+			if rule.Dim != "" && rule.Dim != dim {
+				continue
+			}
+			value, ok := rule.check(s.lists[dim].recent())
+			if ok {
+				firing = true
+				rule.value = value
+				rule.dim = dim
+				break
+			}
+		}
+
+		// handle transitions
+		if firing && !rule.firing {
+			rule.firing = true
+			rule.since = time.Now()
+			go notifyAlert(*rule)
+		} else if !firing {
+			rule.firing = false
+		}
+	}
+}
+
+func notifyAlert(rule alertRule) {
+	// run command
+	if rule.Command != "" {
+		cmd := exec.Command("sh", "-c", rule.Command)
+		cmd.Env = append(os.Environ(),
+			"GOV_ALERT="+rule.title(),
+			"GOV_SERIES="+rule.Series,
+			"GOV_DIM="+rule.dim,
+			"GOV_VALUE="+f2s(rule.value),
+		)
+		err := cmd.Run()
+		if err != nil {
+			println("alert: " + err.Error())
+		}
+	}
+
+	// call webhook
+	if rule.Webhook != "" {
+		data, _ := json.Marshal(map[string]any{
+			"alert":  rule.title(),
+			"series": rule.Series,
+			"dim":    rule.dim,
+			"value":  rule.value,
+			"since":  rule.since,
+		})
+		res, err := http.Post(rule.Webhook, "application/json", bytes.NewReader(data))
+		if err != nil {
+			println("alert: " + err.Error())
+		} else {
+			res.Body.Close()
+		}
+	}
+}
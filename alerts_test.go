@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestAlertRuleCheckPadding(t *testing.T) {
+	// add fewer samples than the list holds
+	l := newList(10)
+	l.add(5)
+	l.add(6)
+
+	// check that the padding is not treated as samples
+	change := &alertRule{Kind: alertChange, Threshold: 1, Window: 2}
+	if _, ok := change.check(l.recent()); ok {
+		t.Fatal("change fired on padding")
+	}
+	below := &alertRule{Kind: alertBelow, Threshold: 1}
+	if _, ok := below.check(newList(10).recent()); ok {
+		t.Fatal("below fired on empty list")
+	}
+
+	// fire once the window is filled
+	l.add(8)
+	if value, ok := change.check(l.recent()); !ok || value != 3 {
+		t.Fatalf("got %v, %v", value, ok)
+	}
+
+	// check wrap around
+	for i := 0; i < 25; i++ {
+		l.add(float64(i))
+	}
+	if recent := l.recent(); len(recent) != 10 || recent[0] != 15 || recent[9] != 24 {
+		t.Fatalf("got %v", recent)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image/color"
+	"strconv"
+	"time"
+
+	"github.com/AllenDang/giu"
+)
+
+type alertWindow struct {
+	open   bool
+	status string
+}
+
+func (w *alertWindow) draw(m *giu.MasterWindow) {
+	// create window
+	win := newWindow(m, "Alerts", giu.WindowFlagsMenuBar).IsOpen(&w.open)
+
+	// collect rows
+	var rows []*giu.TableRowWidget
+	withAlerts(func(rules []*alertRule) {
+		for i, rule := range rules {
+			state := "OK"
+			if rule.firing {
+				state = "Firing since " + rule.since.Format("15:04:05") + " (" + time.Since(rule.since).Round(time.Second).String() + ")"
+			}
+			row := giu.TableRow(
+				giu.Label(rule.title()),
+				giu.Label(rule.Series),
+				giu.Label(rule.condition()),
+				giu.Label(state),
+				giu.Label(rule.dim+" "+f2s(rule.value)),
+				giu.SmallButton("Remove##"+strconv.Itoa(i)).OnClick(func() {
+					removeAlert(rule)
+				}),
+			)
+			if rule.firing {
+				row.BgColor(color.RGBA{R: 120, G: 40, B: 40, A: 255})
+			}
+			rows = append(rows, row)
+		}
+	})
+
+	// draw
+	win.Layout(
+		giu.MenuBar().Layout(
+			giu.MenuItem("Save Rules").OnClick(func() {
+				err := saveAlerts(*alertsPath)
+				if err != nil {
+					w.status = "Save failed: " + err.Error()
+				} else {
+					w.status = "Saved " + *alertsPath
+				}
+			}),
+			giu.Condition(w.status != "", giu.Layout{
+				giu.Label(w.status),
+			}, nil),
+		),
+		giu.Condition(len(rows) == 0, giu.Layout{
+			giu.Label("No rules, load them with -alerts or add them from the context menu of a plot."),
+		}, nil),
+		giu.Table().Flags(giu.TableFlagsRowBg).Columns(
+			giu.TableColumn("Rule").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(2),
+			giu.TableColumn("Series").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(2),
+			giu.TableColumn("Condition").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+			giu.TableColumn("State").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+			giu.TableColumn("Value").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+			giu.TableColumn("").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(70),
+		).Rows(rows...),
+	)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AllenDang/giu"
+	"golang.org/x/exp/trace"
+)
+
+var execTrace *execTraceData
+var execTraceState string
+var execTraceBusy bool
+var execTraceMutex sync.Mutex
+
+type execSpan struct {
+	start time.Duration
+	stop  time.Duration
+	label string
+}
+
+type execRow struct {
+	name  string
+	spans []execSpan
+	busy  time.Duration
+}
+
+func (r *execRow) add(start, stop time.Duration, label string) {
+	r.spans = append(r.spans, execSpan{
+		start: start,
+		stop:  stop,
+		label: label,
+	})
+	r.busy += stop - start
+}
+
+type execRange struct {
+	name  string
+	scope trace.ResourceID
+}
+
+type execTraceData struct {
+	duration   time.Duration
+	cycles     int
+	gc         execRow
+	assists    execRow
+	sweeps     execRow
+	stw        execRow
+	procs      []*execRow
+	goroutines []*execRow
+	latencies  []time.Duration
+}
+
+func (d *execTraceData) addRange(name string, start, stop time.Duration) {
+	// add GC and STW range, only the global mark phase counts towards the GC
+	// cycles and total while assists and sweeps run per goroutine or P and
+	// may overlap
+	switch {
+	case name == "GC concurrent mark phase":
+		d.gc.add(start, stop, name)
+		d.cycles++
+	case name == "GC mark assist":
+		d.assists.add(start, stop, name)
+	case name == "GC incremental sweep":
+		d.sweeps.add(start, stop, name)
+	case strings.HasPrefix(name, "stop-the-world"):
+		d.stw.add(start, stop, name)
+	}
+}
+
+func (d *execTraceData) latency(q float64) time.Duration {
+	// check latencies
+	if len(d.latencies) == 0 {
+		return 0
+	}
+
+	return d.latencies[int(float64(len(d.latencies)-1)*q)]
+}
+
+func captureExecTrace(url string, duration time.Duration) {
+	// set state
+	execTraceMutex.Lock()
+	if execTraceBusy {
+		execTraceMutex.Unlock()
+		return
+	}
+	execTraceBusy = true
+	execTraceState = "Capturing " + duration.String() + "..."
+	execTraceMutex.Unlock()
+
+	// load trace
+	data, err := loadExecTrace(url, duration)
+
+	// set trace or error
+	execTraceMutex.Lock()
+	if err != nil {
+		execTraceState = "Error: " + err.Error()
+	} else {
+		execTrace = data
+		execTraceState = ""
+	}
+	execTraceBusy = false
+	execTraceMutex.Unlock()
+
+	// update
+	giu.Update()
+}
+
+func getExecTrace() (*execTraceData, string, bool) {
+	// acquire mutex
+	execTraceMutex.Lock()
+	defer execTraceMutex.Unlock()
+
+	return execTrace, execTraceState, execTraceBusy
+}
+
+func loadExecTrace(url string, duration time.Duration) (*execTraceData, error) {
+	// get seconds
+	seconds := int(duration / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	// get trace
+	res, err := http.Get(url + "?seconds=" + strconv.Itoa(seconds))
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure close
+	defer res.Body.Close()
+
+	// check status
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return parseExecTrace(res.Body)
+}
+
+func parseExecTrace(r io.Reader) (*execTraceData, error) {
+	// create reader
+	reader, err := trace.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare state
+	var first, last trace.Time
+	var started bool
+	procs := map[trace.ProcID]*execRow{}
+	goroutines := map[trace.GoID]*execRow{}
+	running := map[trace.GoID]trace.Time{}
+	runningOn := map[trace.GoID]trace.ProcID{}
+	runnable := map[trace.GoID]trace.Time{}
+	ranges := map[execRange]trace.Time{}
+	data := &execTraceData{
+		gc:      execRow{name: "GC"},
+		assists: execRow{name: "GC Assists"},
+		sweeps:  execRow{name: "GC Sweeps"},
+		stw:     execRow{name: "STW"},
+	}
+
+	// get offset
+	offset := func(t trace.Time) time.Duration {
+		return t.Sub(first)
+	}
+
+	// get rows
+	procRow := func(id trace.ProcID) *execRow {
+		row := procs[id]
+		if row == nil {
+			row = &execRow{name: "P" + strconv.FormatInt(int64(id), 10)}
+			procs[id] = row
+		}
+		return row
+	}
+	goRow := func(id trace.GoID) *execRow {
+		row := goroutines[id]
+		if row == nil {
+			row = &execRow{name: "G" + strconv.FormatInt(int64(id), 10)}
+			goroutines[id] = row
+		}
+		return row
+	}
+
+	// stop running goroutine
+	stop := func(id trace.GoID, at trace.Time) {
+		start, ok := running[id]
+		if !ok {
+			return
+		}
+		label := "G" + strconv.FormatInt(int64(id), 10)
+		goRow(id).add(offset(start), offset(at), label)
+		if proc, ok := runningOn[id]; ok && proc != trace.NoProc {
+			procRow(proc).add(offset(start), offset(at), label)
+		}
+		delete(running, id)
+		delete(runningOn, id)
+	}
+
+	// read events
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// track time
+		if !started {
+			first = event.Time()
+			started = true
+		}
+		last = event.Time()
+
+		// handle event
+		switch event.Kind() {
+		case trace.EventStateTransition:
+			// check resource
+			st := event.StateTransition()
+			if st.Resource.Kind != trace.ResourceGoroutine {
+				continue
+			}
+
+			// handle transition
+			id := st.Resource.Goroutine()
+			from, to := st.Goroutine()
+			if from == trace.GoRunning {
+				stop(id, event.Time())
+			}
+			switch to {
+			case trace.GoRunnable:
+				runnable[id] = event.Time()
+			case trace.GoRunning:
+				if since, ok := runnable[id]; ok {
+					data.latencies = append(data.latencies, event.Time().Sub(since))
+					delete(runnable, id)
+				}
+				running[id] = event.Time()
+				runningOn[id] = event.Proc()
+			}
+		case trace.EventRangeBegin:
+			ranges[execRange{name: event.Range().Name, scope: event.Range().Scope}] = event.Time()
+		case trace.EventRangeActive:
+			ranges[execRange{name: event.Range().Name, scope: event.Range().Scope}] = first
+		case trace.EventRangeEnd:
+			key := execRange{name: event.Range().Name, scope: event.Range().Scope}
+			start, ok := ranges[key]
+			if !ok {
+				continue
+			}
+			delete(ranges, key)
+			data.addRange(key.name, offset(start), offset(event.Time()))
+		}
+	}
+
+	// close running goroutines
+	for id := range running {
+		stop(id, last)
+	}
+
+	// close open ranges
+	for key, start := range ranges {
+		data.addRange(key.name, offset(start), offset(last))
+	}
+
+	// set duration
+	data.duration = offset(last)
+
+	// sort procs by id
+	for _, row := range procs {
+		data.procs = append(data.procs, row)
+	}
+	sort.Slice(data.procs, func(i, j int) bool {
+		return len(data.procs[i].name) < len(data.procs[j].name) ||
+			len(data.procs[i].name) == len(data.procs[j].name) && data.procs[i].name < data.procs[j].name
+	})
+
+	// sort goroutines by busy time
+	for _, row := range goroutines {
+		data.goroutines = append(data.goroutines, row)
+	}
+	sort.Slice(data.goroutines, func(i, j int) bool {
+		return data.goroutines[i].busy > data.goroutines[j].busy
+	})
+
+	// sort spans
+	for _, rows := range [][]*execRow{data.procs, data.goroutines, {&data.gc, &data.assists, &data.sweeps, &data.stw}} {
+		for _, row := range rows {
+			sort.Slice(row.spans, func(i, j int) bool {
+				return row.spans[i].start < row.spans[j].start
+			})
+		}
+	}
+
+	// sort latencies
+	sort.Slice(data.latencies, func(i, j int) bool {
+		return data.latencies[i] < data.latencies[j]
+	})
+
+	return data, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	rtrace "runtime/trace"
+	"testing"
+	"time"
+)
+
+func TestExecTraceRanges(t *testing.T) {
+	data := &execTraceData{}
+
+	// add a mark phase with overlapping assists and sweeps
+	data.addRange("GC concurrent mark phase", 0, 10*time.Millisecond)
+	data.addRange("GC mark assist", time.Millisecond, 6*time.Millisecond)
+	data.addRange("GC mark assist", 2*time.Millisecond, 8*time.Millisecond)
+	data.addRange("GC mark assist", 3*time.Millisecond, 9*time.Millisecond)
+	data.addRange("GC incremental sweep", 12*time.Millisecond, 13*time.Millisecond)
+	data.addRange("stop-the-world (GC mark termination)", 10*time.Millisecond, 11*time.Millisecond)
+
+	// check that only the mark phase counts towards the GC total
+	if data.cycles != 1 || data.gc.busy != 10*time.Millisecond {
+		t.Fatalf("got %d cycles, %s total", data.cycles, data.gc.busy)
+	}
+	if len(data.assists.spans) != 3 || len(data.sweeps.spans) != 1 || len(data.stw.spans) != 1 {
+		t.Fatalf("got %d assists, %d sweeps and %d pauses", len(data.assists.spans), len(data.sweeps.spans), len(data.stw.spans))
+	}
+}
+
+func TestParseExecTrace(t *testing.T) {
+	// capture trace with a GC cycle
+	var buf bytes.Buffer
+	err := rtrace.Start(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.GC()
+	rtrace.Stop()
+
+	// parse trace
+	data, err := parseExecTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check GC total against the duration
+	if data.cycles == 0 || data.gc.busy > data.duration {
+		t.Fatalf("got %d cycles, %s total over %s", data.cycles, data.gc.busy, data.duration)
+	}
+}
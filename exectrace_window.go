@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/AllenDang/giu"
+)
+
+type execTraceWindow struct {
+	url     string
+	open    bool
+	seconds int32
+	limit   int32
+}
+
+func (w *execTraceWindow) draw(m *giu.MasterWindow) {
+	// create window
+	win := newWindow(m, "Execution Trace", giu.WindowFlagsMenuBar).IsOpen(&w.open)
+
+	// get trace
+	data, state, busy := getExecTrace()
+
+	// collect rows
+	var rows []*giu.TableRowWidget
+	if data != nil {
+		// add GC and STW
+		rows = append(rows, w.buildRow(data, &data.gc, color.RGBA{R: 220, G: 140, B: 50, A: 255}))
+		rows = append(rows, w.buildRow(data, &data.assists, color.RGBA{R: 200, G: 160, B: 90, A: 255}))
+		rows = append(rows, w.buildRow(data, &data.sweeps, color.RGBA{R: 180, G: 150, B: 110, A: 255}))
+		rows = append(rows, w.buildRow(data, &data.stw, color.RGBA{R: 210, G: 60, B: 60, A: 255}))
+
+		// add procs
+		for _, row := range data.procs {
+			rows = append(rows, w.buildRow(data, row, color.RGBA{R: 80, G: 140, B: 200, A: 255}))
+		}
+
+		// add busiest goroutines
+		for i, row := range data.goroutines {
+			if i >= int(w.limit) {
+				break
+			}
+			rows = append(rows, w.buildRow(data, row, color.RGBA{R: 90, G: 170, B: 120, A: 255}))
+		}
+	}
+
+	// draw
+	win.Layout(
+		giu.MenuBar().Layout(
+			giu.MenuItem("Capture").Enabled(!busy).OnClick(func() {
+				go captureExecTrace(w.url, time.Duration(w.seconds)*time.Second)
+			}),
+			giu.SliderInt(&w.seconds, 1, 30).Size(150).Label("Seconds"),
+			giu.SliderInt(&w.limit, 0, 200).Size(150).Label("Goroutines"),
+			giu.Label(state),
+		),
+		giu.Condition(data != nil, giu.Layout{
+			giu.Custom(func() {
+				w.buildSummary(data).Build()
+			}),
+		}, nil),
+		giu.Table().Columns(
+			giu.TableColumn("Resource").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(150),
+			giu.TableColumn("Timeline").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+		).Rows(rows...),
+	)
+}
+
+func (w *execTraceWindow) buildSummary(data *execTraceData) giu.Widget {
+	// get max STW
+	var maxSTW time.Duration
+	for _, span := range data.stw.spans {
+		if d := span.stop - span.start; d > maxSTW {
+			maxSTW = d
+		}
+	}
+
+	return giu.Layout{
+		giu.Labelf("Duration: %s, Procs: %d, Goroutines: %d", data.duration.Round(time.Microsecond), len(data.procs), len(data.goroutines)),
+		giu.Labelf("GC: %d cycles, %s total", data.cycles, data.gc.busy.Round(time.Microsecond)),
+		giu.Labelf("STW: %d pauses, %s total, %s max", len(data.stw.spans), data.stw.busy.Round(time.Microsecond), maxSTW.Round(time.Microsecond)),
+		giu.Labelf("Scheduler Latency: p50 %s, p90 %s, p99 %s, max %s (%d samples)",
+			data.latency(0.5).Round(time.Microsecond),
+			data.latency(0.9).Round(time.Microsecond),
+			data.latency(0.99).Round(time.Microsecond),
+			data.latency(1).Round(time.Microsecond),
+			len(data.latencies),
+		),
+	}
+}
+
+func (w *execTraceWindow) buildRow(data *execTraceData, row *execRow, col color.Color) *giu.TableRowWidget {
+	// get label
+	label := fmt.Sprintf("%s (%s)", row.name, row.busy.Round(time.Microsecond))
+
+	return giu.TableRow(giu.Label(label), giu.Custom(func() {
+		// check duration
+		if data.duration <= 0 {
+			return
+		}
+
+		// get positions
+		width, _ := giu.GetAvailableRegion()
+		ratio := float64(width) / float64(data.duration)
+		pos := giu.GetCursorScreenPos()
+		canvas := giu.GetCanvas()
+
+		// draw spans, coalescing spans within the same pixels
+		start, stop := -1, -1
+		flush := func() {
+			if start >= 0 {
+				canvas.AddRectFilled(pos.Add(image.Pt(start, 0)), pos.Add(image.Pt(stop, 20)), col, 0, 0)
+			}
+		}
+		for _, span := range row.spans {
+			// get pixels
+			spanStart := int(float64(span.start) * ratio)
+			spanStop := int(float64(span.stop) * ratio)
+			if spanStop <= spanStart {
+				spanStop = spanStart + 1
+			}
+
+			// extend or flush
+			if start >= 0 && spanStart <= stop {
+				if spanStop > stop {
+					stop = spanStop
+				}
+				continue
+			}
+			flush()
+			start, stop = spanStart, spanStop
+		}
+		flush()
+
+		// reserve space
+		giu.Dummy(width, 20).Build()
+		giu.Tooltip(label).Build()
+	}))
+}
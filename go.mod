@@ -1,21 +1,24 @@
 module github.com/256dpi/gov
 
-go 1.18
+go 1.26.0
 
 require (
 	github.com/AllenDang/giu v0.6.2
+	github.com/AllenDang/imgui-go v1.12.1-0.20220322114136-499bbf6a42ad
 	github.com/dustin/go-humanize v1.0.0
 	github.com/go-gl/gl v0.0.0-20211210172815-726fda9656d6
 	github.com/google/pprof v0.0.0-20200708004538-1a94d8640e99
+	github.com/gorilla/websocket v1.5.3
 	github.com/prometheus/client_golang v1.13.0
 	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.37.0
 	github.com/samber/lo v1.27.0
+	golang.org/x/exp v0.0.0-20260908205506-85c1c2202aba
+	google.golang.org/protobuf v1.28.1
 )
 
 require (
 	github.com/AllenDang/go-findfont v0.0.0-20200702051237-9f180485aeb8 // indirect
-	github.com/AllenDang/imgui-go v1.12.1-0.20220322114136-499bbf6a42ad // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/faiface/mainthread v0.0.0-20171120011319-8b78f0a41ae3 // indirect
@@ -25,9 +28,7 @@ require (
 	github.com/pkg/browser v0.0.0-20210911075715-681adbf594b8 // indirect
 	github.com/prometheus/procfs v0.8.0 // indirect
 	github.com/sahilm/fuzzy v0.1.0 // indirect
-	golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
 	golang.org/x/image v0.0.0-20220302094943-723b81ca9867 // indirect
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
-	google.golang.org/protobuf v1.28.1 // indirect
 	gopkg.in/eapache/queue.v1 v1.1.0 // indirect
 )
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var goroutineGroups []*goroutineGroup
+var goroutineCounts map[string]int
+var goroutineBaseline map[string]int
+var goroutineTotal *list
+var goroutineMutex sync.Mutex
+
+type goroutineGroup struct {
+	key      string
+	reason   string
+	frames   []string
+	files    []string
+	created  string
+	locked   bool
+	count    int
+	previous int
+	baseline int
+	minWait  time.Duration
+	maxWait  time.Duration
+}
+
+func (g *goroutineGroup) top() string {
+	// get first frame
+	if len(g.frames) > 0 {
+		return g.frames[0]
+	}
+
+	return g.created
+}
+
+func loadGoroutines(url string) error {
+	// get dump
+	res, err := http.Get(url + "?debug=2")
+	if err != nil {
+		return err
+	}
+
+	// ensure close
+	defer res.Body.Close()
+
+	// parse dump
+	groups, err := parseGoroutines(res.Body)
+	if err != nil {
+		return err
+	}
+
+	// acquire mutex
+	goroutineMutex.Lock()
+	defer goroutineMutex.Unlock()
+
+	// ensure baseline
+	first := goroutineBaseline == nil
+	if first {
+		goroutineBaseline = map[string]int{}
+		goroutineTotal = newList(*seriesLength)
+	}
+
+	// diff counts
+	total := 0
+	counts := make(map[string]int, len(groups))
+	for _, group := range groups {
+		if first {
+			goroutineBaseline[group.key] = group.count
+		}
+		group.previous = goroutineCounts[group.key]
+		group.baseline = goroutineBaseline[group.key]
+		counts[group.key] = group.count
+		total += group.count
+	}
+
+	// keep vanished groups until the next load to show the drop to zero
+	for _, group := range goroutineGroups {
+		if group.count > 0 && counts[group.key] == 0 {
+			vanished := *group
+			vanished.count = 0
+			vanished.previous = group.count
+			vanished.baseline = goroutineBaseline[group.key]
+			vanished.minWait = 0
+			vanished.maxWait = 0
+			groups = append(groups, &vanished)
+		}
+	}
+
+	// set groups
+	goroutineGroups = groups
+	goroutineCounts = counts
+	goroutineTotal.add(float64(total))
+
+	return nil
+}
+
+func resetGoroutines() {
+	// acquire mutex
+	goroutineMutex.Lock()
+	defer goroutineMutex.Unlock()
+
+	// reset baseline
+	goroutineBaseline = nil
+	goroutineCounts = nil
+	goroutineTotal = nil
+}
+
+func withGoroutines(fn func(groups []*goroutineGroup, total *list)) {
+	// acquire mutex
+	goroutineMutex.Lock()
+	defer goroutineMutex.Unlock()
+
+	// yield
+	fn(goroutineGroups, goroutineTotal)
+}
+
+func parseGoroutines(r io.Reader) ([]*goroutineGroup, error) {
+	// prepare groups
+	groups := map[string]*goroutineGroup{}
+
+	// prepare current
+	var current *goroutineGroup
+	var wait time.Duration
+	flush := func() {
+		// check current
+		if current == nil {
+			return
+		}
+
+		// compute key
+		current.key = current.reason + "\n" + strings.Join(current.frames, "\n") + "\n" + current.created
+
+		// merge group
+		group := groups[current.key]
+		if group == nil {
+			group = current
+			group.minWait = wait
+			groups[current.key] = group
+		}
+		group.count++
+		if wait < group.minWait {
+			group.minWait = wait
+		}
+		if wait > group.maxWait {
+			group.maxWait = wait
+		}
+
+		// reset
+		current = nil
+		wait = 0
+	}
+
+	// scan lines
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// handle header
+		if strings.HasPrefix(line, "goroutine ") {
+			flush()
+			current = &goroutineGroup{}
+			current.reason, wait, current.locked = parseGoroutineHeader(line)
+			if current.reason == "" {
+				current = nil
+			}
+			continue
+		}
+
+		// skip empty and unknown lines
+		if current == nil || line == "" || strings.HasPrefix(line, "...") {
+			continue
+		}
+
+		// handle files
+		if strings.HasPrefix(line, "\t") {
+			file := strings.TrimSpace(line)
+			if i := strings.LastIndex(file, " +0x"); i > 0 {
+				file = file[:i]
+			}
+			current.files = append(current.files, file)
+			continue
+		}
+
+		// handle creator
+		if strings.HasPrefix(line, "created by ") {
+			created := strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(created, " in goroutine "); i > 0 {
+				created = created[:i]
+			}
+			current.created = created
+			continue
+		}
+
+		// handle frame
+		if i := strings.LastIndex(line, "("); i > 0 {
+			line = line[:i]
+		}
+		current.frames = append(current.frames, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// flush last
+	flush()
+
+	// sort groups
+	sorted := make([]*goroutineGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	return sorted, nil
+}
+
+func parseGoroutineHeader(line string) (string, time.Duration, bool) {
+	// get state
+	start := strings.Index(line, "[")
+	stop := strings.LastIndex(line, "]")
+	if start < 0 || stop < start {
+		return "", 0, false
+	}
+
+	// parse state
+	var reason string
+	var wait time.Duration
+	var locked bool
+	for i, part := range strings.Split(line[start+1:stop], ", ") {
+		switch {
+		case i == 0:
+			reason = part
+		case part == "locked to thread":
+			locked = true
+		case strings.HasSuffix(part, " minutes"):
+			minutes, _ := strconv.Atoi(strings.TrimSuffix(part, " minutes"))
+			wait = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	return reason, wait, locked
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goroutineDump = `goroutine 1 [running]:
+main.main()
+	/app/main.go:12 +0x1d
+
+goroutine 18 [chan receive, 5 minutes]:
+main.worker(0xc000012345)
+	/app/worker.go:20 +0x45
+created by main.main in goroutine 1
+	/app/main.go:10 +0x25
+
+goroutine 19 [chan receive, 7 minutes]:
+main.worker(0xc000012399)
+	/app/worker.go:20 +0x45
+created by main.main in goroutine 1
+	/app/main.go:10 +0x25
+
+goroutine 20 [chan receive]:
+main.worker(0xc0000123aa)
+	/app/worker.go:20 +0x45
+created by main.main in goroutine 1
+	/app/main.go:10 +0x25
+
+goroutine 5 [syscall, 2 minutes, locked to thread]:
+syscall.Syscall6(0x10, 0x3, 0x0)
+	/usr/local/go/src/syscall/syscall_linux.go:91 +0x36
+os/signal.loop()
+	/usr/local/go/src/os/signal/signal_unix.go:23 +0x13
+created by os/signal.Notify.func1.1 in goroutine 1
+	/usr/local/go/src/os/signal/signal.go:151 +0x1f
+`
+
+func TestParseGoroutines(t *testing.T) {
+	for _, item := range []struct {
+		name   string
+		dump   string
+		groups []goroutineGroup
+	}{
+		{
+			name: "Dump",
+			dump: goroutineDump,
+			groups: []goroutineGroup{
+				{reason: "chan receive", frames: []string{"main.worker"}, created: "main.main", count: 3, maxWait: 7 * time.Minute},
+				{reason: "running", frames: []string{"main.main"}, count: 1},
+				{reason: "syscall", frames: []string{"syscall.Syscall6", "os/signal.loop"}, created: "os/signal.Notify.func1.1", locked: true, count: 1, minWait: 2 * time.Minute, maxWait: 2 * time.Minute},
+			},
+		},
+		{
+			name: "TruncatedFrame",
+			dump: "goroutine 1 [running]:\nmain.main()\n\t/app/main.go:12 +0x1d\n\ngoroutine 7 [select]:\nmain.lo",
+			groups: []goroutineGroup{
+				{reason: "running", frames: []string{"main.main"}, count: 1},
+				{reason: "select", frames: []string{"main.lo"}, count: 1},
+			},
+		},
+		{
+			name: "TruncatedHeader",
+			dump: "goroutine 1 [running]:\nmain.main()\n\t/app/main.go:12 +0x1d\n\ngoroutine 7 [sel",
+			groups: []goroutineGroup{
+				{reason: "running", frames: []string{"main.main"}, count: 1},
+			},
+		},
+		{
+			name: "Empty",
+			dump: "",
+		},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			groups, err := parseGoroutines(strings.NewReader(item.dump))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(groups) != len(item.groups) {
+				t.Fatalf("got %d groups, want %d", len(groups), len(item.groups))
+			}
+			for i, group := range groups {
+				want := item.groups[i]
+				if group.reason != want.reason || strings.Join(group.frames, ",") != strings.Join(want.frames, ",") ||
+					group.created != want.created || group.locked != want.locked || group.count != want.count ||
+					group.minWait != want.minWait || group.maxWait != want.maxWait {
+					t.Fatalf("group %d: got %+v, want %+v", i, *group, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadGoroutinesVanished(t *testing.T) {
+	resetGoroutines()
+	defer resetGoroutines()
+
+	// serve the full dump first and only the main goroutine afterwards
+	var loads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loads++
+		if loads == 1 {
+			_, _ = fmt.Fprint(w, goroutineDump)
+		} else {
+			_, _ = fmt.Fprint(w, "goroutine 1 [running]:\nmain.main()\n\t/app/main.go:12 +0x1d\n")
+		}
+	}))
+	defer server.Close()
+
+	// find group
+	find := func(reason string) *goroutineGroup {
+		var found *goroutineGroup
+		withGoroutines(func(groups []*goroutineGroup, _ *list) {
+			for _, group := range groups {
+				if group.reason == reason {
+					found = group
+				}
+			}
+		})
+		return found
+	}
+
+	// load twice, the workers vanish
+	for i := 0; i < 2; i++ {
+		err := loadGoroutines(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	group := find("chan receive")
+	if group == nil || group.count != 0 || group.count-group.previous != -3 || group.count-group.baseline != -3 {
+		t.Fatalf("got %+v", group)
+	}
+
+	// load again, the vanished groups are gone
+	err := loadGoroutines(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group := find("chan receive"); group != nil {
+		t.Fatalf("got %+v", group)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AllenDang/giu"
+)
+
+type goroutineWindow struct {
+	open bool
+}
+
+func (w *goroutineWindow) draw(m *giu.MasterWindow) {
+	// create window
+	win := newWindow(m, "Goroutines", giu.WindowFlagsMenuBar).IsOpen(&w.open)
+
+	// get size
+	width, _ := win.CurrentSize()
+
+	// collect rows
+	var rows []*giu.TreeTableRowWidget
+	var series []float64
+	withGoroutines(func(groups []*goroutineGroup, total *list) {
+		// get series
+		if total != nil {
+			series = append(series, total.slice()...)
+		}
+
+		// add groups
+		for i, group := range groups {
+			// prepare frames
+			frames := make([]*giu.TreeTableRowWidget, 0, len(group.frames)+1)
+			for j, frame := range group.frames {
+				var file string
+				if j < len(group.files) {
+					file = group.files[j]
+				}
+				frames = append(frames, giu.TreeTableRow(frame+"##"+strconv.Itoa(i)+":"+strconv.Itoa(j),
+					giu.Label(""), giu.Label(""), giu.Label(""), giu.Label(""), giu.Label(""), giu.Label(file),
+				).Flags(giu.TreeNodeFlagsLeaf))
+			}
+			if group.created != "" {
+				frames = append(frames, giu.TreeTableRow("created by "+group.created+"##"+strconv.Itoa(i),
+					giu.Label(""), giu.Label(""), giu.Label(""), giu.Label(""), giu.Label(""), giu.Label(""),
+				).Flags(giu.TreeNodeFlagsLeaf))
+			}
+
+			// get state
+			state := group.reason
+			if group.locked {
+				state += " (locked)"
+			}
+
+			// get wait
+			var wait string
+			if group.maxWait > 0 {
+				wait = fmt.Sprintf("%s - %s", group.minWait, group.maxWait)
+			}
+
+			// add row
+			rows = append(rows, giu.TreeTableRow(group.top()+"##"+strconv.Itoa(i),
+				giu.Label(strconv.Itoa(group.count)),
+				giu.Label(fmtDelta(group.count-group.previous)),
+				giu.Label(fmtDelta(group.count-group.baseline)),
+				giu.Label(state),
+				giu.Label(wait),
+				giu.Label(""),
+			).Children(frames...))
+		}
+	})
+
+	// draw
+	win.Layout(
+		giu.MenuBar().Layout(
+			giu.MenuItem("Reset Baseline").OnClick(resetGoroutines),
+		),
+		giu.Condition(len(series) > 0, giu.Layout{
+			giu.Plot("Goroutines").
+				Size(int(width)-20, 150).
+				XAxeFlags(giu.PlotAxisFlagsNoTickLabels|giu.PlotAxisFlagsAutoFit).
+				YAxeFlags(giu.PlotAxisFlagsAutoFit, 0, 0).
+				Flags(giu.PlotFlagsNoLegend).
+				Plots(giu.PlotLine("total", series)),
+		}, nil),
+		giu.TreeTable().Columns(
+			giu.TableColumn("Stack").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+			giu.TableColumn("Count").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(60),
+			giu.TableColumn("Last").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(60),
+			giu.TableColumn("Baseline").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(60),
+			giu.TableColumn("State").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(150),
+			giu.TableColumn("Wait").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(150),
+			giu.TableColumn("Location").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+		).Rows(rows...),
+	)
+}
+
+func fmtDelta(d int) string {
+	// format sign
+	if d > 0 {
+		return "+" + strconv.Itoa(d)
+	}
+
+	return strconv.Itoa(d)
+}
@@ -0,0 +1,80 @@
+// Package instrument exposes all endpoints gov collects from.
+//
+// Mount the endpoints on an existing mux or serve them separately:
+//
+//	instrument.Mount(http.DefaultServeMux)
+//
+//	go http.ListenAndServe(":6060", instrument.Handler())
+//
+// The paths match the defaults of gov, block and mutex profiling is enabled
+// using BlockProfileRate and MutexProfileFraction. The profile handlers of
+// net/http/pprof are mounted explicitly, note that importing net/http/pprof
+// also registers them on http.DefaultServeMux.
+package instrument
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/256dpi/gov/trace"
+)
+
+// BlockProfileRate is the block profile rate set by Mount, see
+// runtime.SetBlockProfileRate.
+var BlockProfileRate = 10000
+
+// MutexProfileFraction is the mutex profile fraction set by Mount, see
+// runtime.SetMutexProfileFraction.
+var MutexProfileFraction = 10
+
+var profileNames = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+// Handler returns a new handler serving all endpoints.
+func Handler() http.Handler {
+	// create mux
+	mux := http.NewServeMux()
+	Mount(mux)
+
+	return mux
+}
+
+// Mount registers the metrics, profile and trace endpoints on the provided
+// mux and enables block and mutex profiling. Paths that are already registered,
+// e.g. by net/http/pprof or a previous call, are skipped. Mount may therefore
+// be called multiple times on the same mux.
+func Mount(mux *http.ServeMux) {
+	// enable profiles
+	runtime.SetBlockProfileRate(BlockProfileRate)
+	runtime.SetMutexProfileFraction(MutexProfileFraction)
+
+	// register metrics
+	handle(mux, "/metrics", promhttp.Handler())
+
+	// register profiles
+	handle(mux, "/debug/pprof/", http.HandlerFunc(pprof.Index))
+	handle(mux, "/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	handle(mux, "/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	handle(mux, "/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	handle(mux, "/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	for _, name := range profileNames {
+		handle(mux, "/debug/pprof/"+name, pprof.Handler(name))
+	}
+
+	// register traces
+	handle(mux, "/trace", trace.Handler())
+}
+
+func handle(mux *http.ServeMux, pattern string, handler http.Handler) {
+	// skip already registered patterns as the mux panics on duplicates
+	_, existing := mux.Handler(&http.Request{Method: "GET", URL: &url.URL{Path: pattern}})
+	if existing == pattern {
+		return
+	}
+
+	// register handler
+	mux.Handle(pattern, handler)
+}
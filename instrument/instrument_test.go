@@ -0,0 +1,71 @@
+package instrument
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	// serve request
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	// read body
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.Code, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler()
+
+	// check endpoints
+	for _, path := range []string{"/metrics", "/debug/pprof/heap", "/debug/pprof/allocs", "/debug/pprof/goroutine?debug=2", "/debug/pprof/profile?seconds=1", "/debug/pprof/trace?seconds=1"} {
+		code, body := get(t, handler, path)
+		if code != http.StatusOK || body == "" {
+			t.Fatalf("%s: got %d, %q", path, code, body)
+		}
+	}
+
+	// check index
+	code, body := get(t, handler, "/debug/pprof/")
+	if code != http.StatusOK || !strings.Contains(body, "heap") {
+		t.Fatalf("got %d, %q", code, body)
+	}
+
+	// check unknown profile
+	code, _ = get(t, handler, "/debug/pprof/missing")
+	if code != http.StatusNotFound {
+		t.Fatalf("got %d", code)
+	}
+
+	// check symbol lookup
+	code, body = get(t, handler, "/debug/pprof/symbol")
+	if code != http.StatusOK || !strings.HasPrefix(body, "num_symbols:") {
+		t.Fatalf("got %d, %q", code, body)
+	}
+}
+
+func TestMountTwice(t *testing.T) {
+	// register a path up front
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "custom")
+	})
+
+	// mount twice
+	Mount(mux)
+	Mount(mux)
+
+	// check that the existing handler is kept
+	_, body := get(t, mux, "/metrics")
+	if body != "custom" {
+		t.Fatalf("got %q", body)
+	}
+}
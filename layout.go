@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AllenDang/giu"
+	"github.com/samber/lo"
+)
+
+var windowPlacements = map[string]windowPlacement{}
+var windowPlacementsMutex sync.Mutex
+
+type windowPlacement struct {
+	X      float32 `json:"x"`
+	Y      float32 `json:"y"`
+	Width  float32 `json:"width"`
+	Height float32 `json:"height"`
+}
+
+type layout struct {
+	Metrics    []metricLayout  `json:"metrics,omitempty"`
+	Traces     []traceLayout   `json:"traces,omitempty"`
+	Profiles   []profileLayout `json:"profiles,omitempty"`
+	Goroutines *windowLayout   `json:"goroutines,omitempty"`
+	ExecTrace  *windowLayout   `json:"execTrace,omitempty"`
+	Alerts     *windowLayout   `json:"alerts,omitempty"`
+}
+
+type windowLayout struct {
+	Placement windowPlacement `json:"placement"`
+}
+
+type metricLayout struct {
+	windowLayout
+	Path        []string `json:"path"`
+	Columns     int32    `json:"columns"`
+	Interactive bool     `json:"interactive"`
+}
+
+type traceLayout struct {
+	windowLayout
+	Name    string        `json:"name"`
+	Span    time.Duration `json:"span,omitempty"`
+	Inspect bool          `json:"inspect,omitempty"`
+}
+
+type profileLayout struct {
+	windowLayout
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Sample      string `json:"sample"`
+	Granularity int32  `json:"granularity"`
+	Paused      bool   `json:"paused,omitempty"`
+	Focus       string `json:"focus,omitempty"`
+	Ignore      string `json:"ignore,omitempty"`
+	Hide        string `json:"hide,omitempty"`
+	Show        string `json:"show,omitempty"`
+	Prune       bool   `json:"prune,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Search      string `json:"search,omitempty"`
+	Pivot       bool   `json:"pivot,omitempty"`
+}
+
+func (l *layout) validate() error {
+	// check metric windows
+	for _, ml := range l.Metrics {
+		if len(ml.Path) == 0 {
+			return errors.New("metric window: missing path")
+		}
+	}
+
+	// check trace windows
+	for _, tl := range l.Traces {
+		if tl.Name == "" {
+			return errors.New("trace window: missing name")
+		}
+	}
+
+	// check profile windows
+	for _, pl := range l.Profiles {
+		samples, ok := profileSamples[pl.Name]
+		if pl.Name == "file" {
+			if prf, _ := getProfile(pl.Name); prf == nil {
+				return fmt.Errorf("profile window %q: no profile file opened", pl.Title)
+			}
+		} else if !ok {
+			return fmt.Errorf("profile window %q: unknown profile %q", pl.Title, pl.Name)
+		} else if pl.Sample != "" && !lo.Contains(samples, pl.Sample) {
+			return fmt.Errorf("profile window %q: invalid sample %q", pl.Title, pl.Sample)
+		}
+		if pl.Granularity < 0 || int(pl.Granularity) >= len(profileGranularities) {
+			return fmt.Errorf("profile window %q: invalid granularity %d", pl.Title, pl.Granularity)
+		}
+	}
+
+	return nil
+}
+
+func takePlacement(title string) (windowPlacement, bool) {
+	// acquire mutex
+	windowPlacementsMutex.Lock()
+	defer windowPlacementsMutex.Unlock()
+
+	// take placement
+	p, ok := windowPlacements[title]
+	delete(windowPlacements, title)
+
+	return p, ok
+}
+
+func placeWindow(title string, p windowPlacement) {
+	// check placement
+	if p.Width <= 0 || p.Height <= 0 {
+		return
+	}
+
+	// acquire mutex
+	windowPlacementsMutex.Lock()
+	defer windowPlacementsMutex.Unlock()
+
+	// set placement
+	windowPlacements[title] = p
+}
+
+func getPlacement(title string) windowPlacement {
+	// get current position and size
+	win := giu.Window(title)
+	x, y := win.CurrentPosition()
+	w, h := win.CurrentSize()
+
+	return windowPlacement{X: x, Y: y, Width: w, Height: h}
+}
+
+func saveLayout(path string) error {
+	// prepare layout
+	var l layout
+
+	// add metric windows
+	for _, win := range metricWindows {
+		l.Metrics = append(l.Metrics, metricLayout{
+			windowLayout: windowLayout{Placement: getPlacement(win.node.title())},
+			Path:         win.node.path(),
+			Columns:      win.cols,
+			Interactive:  win.inter,
+		})
+	}
+
+	// add trace windows
+	for _, win := range traceWindows {
+		l.Traces = append(l.Traces, traceLayout{
+			windowLayout: windowLayout{Placement: getPlacement(win.name)},
+			Name:         win.name,
+			Span:         win.span,
+			Inspect:      win.inspect,
+		})
+	}
+
+	// add profile windows
+	for _, win := range profileWindows {
+		l.Profiles = append(l.Profiles, profileLayout{
+			windowLayout: windowLayout{Placement: getPlacement(win.title)},
+			Name:         win.name,
+			Title:        win.title,
+			Sample:       win.sample,
+			Granularity:  win.gran,
+			Paused:       !win.stream,
+			Focus:        win.filter.focus,
+			Ignore:       win.filter.ignore,
+			Hide:         win.filter.hide,
+			Show:         win.filter.show,
+			Prune:        win.filter.prune,
+			Tag:          win.filter.tag,
+			Value:        win.filter.value,
+			Search:       win.search,
+			Pivot:        win.pivot,
+		})
+	}
+
+	// add other windows
+	if goroutinesWindow != nil {
+		l.Goroutines = &windowLayout{Placement: getPlacement("Goroutines")}
+	}
+	if execWindow != nil {
+		l.ExecTrace = &windowLayout{Placement: getPlacement("Execution Trace")}
+	}
+	if alertsWindow != nil {
+		l.Alerts = &windowLayout{Placement: getPlacement("Alerts")}
+	}
+
+	// encode layout
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func loadLayout(path, execURL string) error {
+	// read file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// decode layout
+	var l layout
+	err = json.Unmarshal(data, &l)
+	if err != nil {
+		return err
+	}
+
+	// check layout
+	err = l.validate()
+	if err != nil {
+		return err
+	}
+
+	// close windows
+	clear(metricWindows)
+	clear(traceWindows)
+	clear(profileWindows)
+	goroutinesWindow = nil
+	execWindow = nil
+	alertsWindow = nil
+
+	// clear placements of closed windows
+	windowPlacementsMutex.Lock()
+	clear(windowPlacements)
+	windowPlacementsMutex.Unlock()
+
+	// open metric windows, nodes are created if not yet scraped
+	for _, ml := range l.Metrics {
+		metricsMutex.Lock()
+		node := metricsTree.ensure(ml.Path)
+		metricsMutex.Unlock()
+		metricWindows[node.title()] = &metricWindow{
+			node:  node,
+			cols:  max(ml.Columns, 1),
+			inter: ml.Interactive,
+			open:  true,
+		}
+		placeWindow(node.title(), ml.Placement)
+	}
+
+	// open trace windows, streams are shown once received
+	for _, tl := range l.Traces {
+		traceWindows[tl.Name] = &traceWindow{
+			name:    tl.Name,
+			open:    true,
+			span:    tl.Span,
+			inspect: tl.Inspect,
+		}
+		placeWindow(tl.Name, tl.Placement)
+	}
+
+	// open profile windows
+	for _, pl := range l.Profiles {
+		profileWindows[pl.Name] = &profileWindow{
+			name:   pl.Name,
+			title:  pl.Title,
+			sample: pl.Sample,
+			gran:   pl.Granularity,
+			open:   true,
+			stream: !pl.Paused,
+			filter: profileFilter{
+				focus:  pl.Focus,
+				ignore: pl.Ignore,
+				hide:   pl.Hide,
+				show:   pl.Show,
+				prune:  pl.Prune,
+				tag:    pl.Tag,
+				value:  pl.Value,
+			},
+			search: pl.Search,
+			pivot:  pl.Pivot,
+		}
+		placeWindow(pl.Title, pl.Placement)
+	}
+
+	// open other windows
+	if l.Goroutines != nil {
+		goroutinesWindow = &goroutineWindow{open: true}
+		placeWindow("Goroutines", l.Goroutines.Placement)
+	}
+	if l.ExecTrace != nil {
+		execWindow = &execTraceWindow{url: execURL, open: true, seconds: 1, limit: 50}
+		placeWindow("Execution Trace", l.ExecTrace.Placement)
+	}
+	if l.Alerts != nil {
+		alertsWindow = &alertWindow{open: true}
+		placeWindow("Alerts", l.Alerts.Placement)
+	}
+
+	return nil
+}
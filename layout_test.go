@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestLayoutValidate(t *testing.T) {
+	// check valid layout
+	valid := layout{
+		Metrics:  []metricLayout{{Path: []string{"go", "memstats"}}},
+		Traces:   []traceLayout{{Name: "api"}},
+		Profiles: []profileLayout{{Name: "heap", Sample: "inuse_space", Granularity: 2}, {Name: "cpu"}},
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check invalid layouts
+	for _, item := range []struct {
+		layout layout
+		err    string
+	}{
+		{layout{Metrics: []metricLayout{{}}}, "missing path"},
+		{layout{Traces: []traceLayout{{}}}, "missing name"},
+		{layout{Profiles: []profileLayout{{Name: "foo"}}}, "unknown profile"},
+		{layout{Profiles: []profileLayout{{Name: "file"}}}, "no profile file"},
+		{layout{Profiles: []profileLayout{{Name: "cpu", Sample: "delay"}}}, "invalid sample"},
+		{layout{Profiles: []profileLayout{{Name: "cpu", Granularity: 4}}}, "invalid granularity"},
+		{layout{Profiles: []profileLayout{{Name: "cpu", Granularity: -1}}}, "invalid granularity"},
+	} {
+		err := item.layout.validate()
+		if err == nil || !strings.Contains(err.Error(), item.err) {
+			t.Fatalf("got %v, want %q", err, item.err)
+		}
+	}
+
+	// check opened file with any sample
+	profilesMutex.Lock()
+	profiles["file"] = &profile.Profile{}
+	profilesMutex.Unlock()
+	defer func() {
+		profilesMutex.Lock()
+		delete(profiles, "file")
+		profilesMutex.Unlock()
+	}()
+	file := layout{Profiles: []profileLayout{{Name: "file", Sample: "custom"}}}
+	if err := file.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
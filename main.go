@@ -1,15 +1,21 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"image/color"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/AllenDang/giu"
 	"github.com/AllenDang/imgui-go"
 	"github.com/go-gl/gl/v3.2-core/gl"
+	"github.com/google/pprof/profile"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/samber/lo"
 )
@@ -17,20 +23,34 @@ import (
 var seriesLength = flag.Int("series-length", 100, "the series length")
 var metricsPath = flag.String("metrics-path", "/metrics", "the metrics path")
 var tracePath = flag.String("traces-path", "/trace", "the trace path")
+var traceURL = flag.String("traces-url", "", "the full trace stream URL, e.g. ws://localhost:6060/trace")
 var cpuProfilePath = flag.String("cpu-profile-path", "/debug/pprof/profile", "the CPU profile path")
 var allocsProfilePath = flag.String("allocs-profile-path", "/debug/pprof/allocs", "the allocs profile path")
 var heapProfilePath = flag.String("heap-profile-path", "/debug/pprof/heap", "the heap profile path")
 var blockProfilePath = flag.String("block-profile-path", "/debug/pprof/block", "the block profile path")
 var mutexProfilePath = flag.String("mutex-profile-path", "/debug/pprof/mutex", "the mutex profile path")
+var goroutineProfilePath = flag.String("goroutine-profile-path", "/debug/pprof/goroutine", "the goroutine profile path")
+var execTracePath = flag.String("exec-trace-path", "/debug/pprof/trace", "the execution trace path")
+var threadcreateProfilePath = flag.String("threadcreate-profile-path", "/debug/pprof/threadcreate", "the threadcreate profile path")
+var traceLength = flag.Duration("trace-length", 10*time.Second, "the trace history length")
+var traceLimit = flag.Int("trace-limit", 100000, "the maximum number of trace events kept")
 var scrapeInterval = flag.Duration("scrape-interval", 250*time.Millisecond, "the default scrape interval")
 var profileInterval = flag.Duration("profile-interval", 2*time.Second, "the default profile interval")
 var initColumns = flag.Int("columns", 3, "the default number of columns")
 var selfAddr = flag.String("self-addr", ":7070", "the address for govs own metrics")
 var metricsSplitDepth = flag.Int("metrics-split-depth", 3, "the metrics split depth")
+var sourceRoot = flag.String("source-root", "", "the local source roots used to show profiled source")
+var exportDir = flag.String("export-dir", ".", "the directory for exported profiles")
+var alertsPath = flag.String("alerts", "alerts.json", "the alert rules file")
+var layoutPath = flag.String("layout", "", "the layout file opened at startup")
+var diffBase = flag.String("diff-base", "", "the base profile subtracted from opened profile files")
 
 var metricWindows = map[string]*metricWindow{}
 var traceWindows = map[string]*traceWindow{}
 var profileWindows = map[string]*profileWindow{}
+var goroutinesWindow *goroutineWindow
+var execWindow *execTraceWindow
+var alertsWindow *alertWindow
 
 var autoUpdate = false
 
@@ -38,34 +58,112 @@ func main() {
 	// parse flags
 	flag.Parse()
 
-	// run prometheus and pprof profile endpoint
-	http.Handle("/metrics", promhttp.Handler())
-	go func() {
-		panic(http.ListenAndServe(*selfAddr, nil))
-	}()
+	// check local profiles
+	local := flag.Arg(0) == "profile"
+
+	// run prometheus, pprof profile and OTLP trace endpoint if not local
+	if !local {
+		http.Handle("/metrics", promhttp.Handler())
+		http.HandleFunc("/v1/traces", receiveOTLP)
+		go func() {
+			panic(http.ListenAndServe(*selfAddr, nil))
+		}()
+	}
 
-	// get target
-	target := strings.TrimRight(flag.Arg(0), "/")
-	if target == "" {
-		target = "http://0.0.0.0:6060"
+	// load alert rules if available
+	err := loadAlerts(*alertsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		println("alerts: " + err.Error())
+	}
+
+	// run trace metrics loader
+	go traceMetricsLoader()
+
+	// open local profiles
+	if local {
+		// parse command flags, the base may also be given before the command
+		profileFlags := flag.NewFlagSet("profile", flag.ExitOnError)
+		profileFlags.StringVar(diffBase, "diff-base", *diffBase, "the base profile subtracted from opened profile files")
+		_ = profileFlags.Parse(flag.Args()[1:])
+
+		// get files
+		files := profileFlags.Args()
+		if len(files) == 0 || lo.ContainsBy(files, func(file string) bool {
+			return strings.HasPrefix(file, "-")
+		}) {
+			println("usage: gov profile [-diff-base file] file [file...]")
+			os.Exit(2)
+		}
+
+		// open profiles
+		err := openProfiles("file", files, *diffBase)
+		if err != nil {
+			println("profile: " + err.Error())
+			os.Exit(1)
+		}
+
+		// get title
+		title := strings.Join(lo.Map(files, func(file string, _ int) string {
+			return filepath.Base(file)
+		}), " + ")
+		if *diffBase != "" {
+			title += " - " + filepath.Base(*diffBase)
+		}
+
+		// open window
+		profileWindows["file"] = &profileWindow{
+			name:   "file",
+			title:  title,
+			open:   true,
+			stream: true,
+		}
+	}
+
+	// get targets
+	targets := lo.Map(flag.Args(), func(arg string, _ int) string {
+		return strings.TrimRight(arg, "/")
+	})
+	if len(targets) == 0 || targets[0] == "" || local {
+		targets = []string{"http://0.0.0.0:6060"}
+	}
+
+	// get primary target
+	target := targets[0]
+
+	// prepare layout
+	currentLayout := lo.Ternary(*layoutPath != "", *layoutPath, "layout.json")
+	var layoutStatus string
+	if *layoutPath != "" {
+		err := loadLayout(*layoutPath, target+*execTracePath)
+		if err != nil {
+			println("layout: " + err.Error())
+		}
 	}
 
 	// create master window
-	master := giu.NewMasterWindow(target, 1400, 900, 0)
+	master := giu.NewMasterWindow(lo.Ternary(local, "gov", strings.Join(targets, ", ")), 1400, 900, 0)
 
 	// allow long draw lists
 	imgui.CurrentIO().SetBackendFlags(imgui.BackendFlagsRendererHasVtxOffset)
 
-	// run metrics and trace loader
-	go metricsLoader(target + *metricsPath)
-	go traceLoader(target + *tracePath)
-
-	// run profiler loaders
-	go profileLoader("cpu", "cpu", target+*cpuProfilePath)
-	go profileLoader("allocs", "alloc_space", target+*allocsProfilePath)
-	go profileLoader("heap", "inuse_space", target+*heapProfilePath)
-	go profileLoader("block", "delay", target+*blockProfilePath)
-	go profileLoader("mutex", "delay", target+*mutexProfilePath)
+	// run loaders if not local
+	if !local {
+		// run metrics and trace loader
+		go metricsLoader(target + *metricsPath)
+		go traceLoader(lo.Ternary(*traceURL != "", *traceURL, target+*tracePath))
+
+		// run profiler loaders for all targets
+		go profileLoader("cpu", targets, *cpuProfilePath, sampledProfile)
+		go profileLoader("allocs", targets, *allocsProfilePath, deltaProfile)
+		go profileLoader("heap", targets, *heapProfilePath, deltaProfile)
+		go profileLoader("block", targets, *blockProfilePath, deltaProfile)
+		go profileLoader("mutex", targets, *mutexProfilePath, deltaProfile)
+		go profileLoader("goroutine", targets, *goroutineProfilePath, snapshotProfile)
+		go profileLoader("threadcreate", targets, *threadcreateProfilePath, snapshotProfile)
+
+		// run goroutine loader
+		go goroutineLoader(target + *goroutineProfilePath)
+	}
 
 	// prepare scrape intervals
 	scrapeIntervals := []time.Duration{
@@ -83,6 +181,14 @@ func main() {
 		10 * time.Second,
 	}
 
+	// prepare trace lengths
+	traceLengths := []time.Duration{
+		10 * time.Second,
+		30 * time.Second,
+		1 * time.Minute,
+		5 * time.Minute,
+	}
+
 	// run periodic updater (50 Hz)
 	go func() {
 		for range time.Tick(20 * time.Millisecond) {
@@ -104,18 +210,77 @@ func main() {
 		// main menu
 		withMetricsTree(func(tree *metricsNode) {
 			giu.MainMenuBar().Layout(
-				giu.Menu("Metrics").Layout(
-					buildMetricsMenuItems(tree)...,
+				giu.Condition(!local, giu.Layout{
+					giu.Menu("Metrics").Layout(
+						buildMetricsMenuItems(tree)...,
+					),
+					giu.Menu("Traces").Layout(
+						giu.Layout(buildTracesMenuItems()),
+						giu.Separator(),
+						giu.MenuItem("Execution Trace").OnClick(func() {
+							if execWindow == nil {
+								execWindow = &execTraceWindow{
+									url:     target + *execTracePath,
+									open:    true,
+									seconds: 1,
+									limit:   50,
+								}
+							}
+						}),
+					),
+				}, nil),
+				giu.Menu("Profiles").Layout(
+					giu.Condition(local, giu.Layout{
+						giu.MenuItem("File").OnClick(func() {
+							if profileWindows["file"] == nil {
+								profileWindows["file"] = &profileWindow{
+									name:   "file",
+									title:  "File",
+									open:   true,
+									stream: true,
+								}
+							}
+						}),
+					}, giu.Layout{
+						buildProfileMenuItem("cpu", "CPU", "cpu"),
+						buildProfileMenuItem("allocs", "Allocs", "alloc_space"),
+						buildProfileMenuItem("heap", "Heap", "inuse_space"),
+						buildProfileMenuItem("block", "Block", "delay"),
+						buildProfileMenuItem("mutex", "Mutex", "delay"),
+						buildProfileMenuItem("goroutine", "Goroutine", "goroutine"),
+						buildProfileMenuItem("threadcreate", "Threadcreate", "threadcreate"),
+						giu.Separator(),
+						giu.MenuItem("Goroutine Dump").OnClick(func() {
+							if goroutinesWindow == nil {
+								goroutinesWindow = &goroutineWindow{
+									open: true,
+								}
+							}
+						}),
+					}),
 				),
-				giu.Menu("Traces").Layout(
-					buildTracesMenuItems()...,
+				giu.Menu("Alerts").Layout(
+					giu.MenuItem("Rules").OnClick(func() {
+						if alertsWindow == nil {
+							alertsWindow = &alertWindow{
+								open: true,
+							}
+						}
+					}),
 				),
-				giu.Menu("Profiles").Layout(
-					buildProfileMenuItem("cpu", "CPU"),
-					buildProfileMenuItem("allocs", "Allocs"),
-					buildProfileMenuItem("heap", "Heap"),
-					buildProfileMenuItem("block", "Block"),
-					buildProfileMenuItem("mutex", "Mutex"),
+				giu.Menu("Layout").Layout(
+					giu.InputText(&currentLayout).Label("File").Size(200),
+					giu.MenuItem("Save Layout").OnClick(func() {
+						err := saveLayout(currentLayout)
+						layoutStatus = lo.Ternary(err != nil, "Save failed: "+fmt.Sprint(err), "Saved "+currentLayout)
+					}),
+					giu.MenuItem("Load Layout").OnClick(func() {
+						err := loadLayout(currentLayout, target+*execTracePath)
+						layoutStatus = lo.Ternary(err != nil, "Load failed: "+fmt.Sprint(err), "Loaded "+currentLayout)
+					}),
+					giu.Condition(layoutStatus != "", giu.Layout{
+						giu.Label(layoutStatus),
+					}, nil),
 				),
 				giu.Menu("Settings").Layout(
 					giu.Menu("Scrape Interval").Layout(
@@ -132,7 +297,15 @@ func main() {
 							})
 						})...,
 					),
+					giu.Menu("Trace History").Layout(
+						lo.Map(traceLengths, func(length time.Duration, _ int) giu.Widget {
+							return giu.MenuItem(length.String()).Selected(*traceLength == length).OnClick(func() {
+								*traceLength = length
+							})
+						})...,
+					),
 				),
+				giu.Custom(buildAlertsBanner),
 			).Build()
 		})
 
@@ -170,14 +343,46 @@ func main() {
 				win.draw(master)
 			}
 		}
+
+		// draw goroutine window
+		if goroutinesWindow != nil {
+			if !goroutinesWindow.open {
+				goroutinesWindow = nil
+			} else {
+				goroutinesWindow.draw(master)
+			}
+		}
+
+		// draw execution trace window
+		if execWindow != nil {
+			if !execWindow.open {
+				execWindow = nil
+			} else {
+				execWindow.draw(master)
+			}
+		}
+
+		// draw alerts window
+		if alertsWindow != nil {
+			if !alertsWindow.open {
+				alertsWindow = nil
+			} else {
+				alertsWindow.draw(master)
+			}
+		}
 	})
 }
 
 func buildMetricsMenuItems(node *metricsNode) []giu.Widget {
-	// prepare click handler
+	// prepare click handler, windows are keyed by the full path as leaves
+	// like the derived trace metrics share their names, reopening a window
+	// attaches it to the node that may have been recreated
 	click := func() {
-		if metricWindows[node.name] == nil {
-			metricWindows[node.name] = &metricWindow{
+		title := node.title()
+		if win := metricWindows[title]; win != nil {
+			win.node = node
+		} else {
+			metricWindows[title] = &metricWindow{
 				node: node,
 				cols: int32(*initColumns),
 				open: true,
@@ -229,15 +434,50 @@ func buildTracesMenuItems() []giu.Widget {
 	}
 	traceMutex.Unlock()
 
+	// add status
+	if status := getTraceStatus(); status != "" {
+		widgets = append(widgets,
+			giu.Separator(),
+			giu.Label("Stream: "+status),
+			giu.Condition(getTraceInvalid() > 0, giu.Layout{
+				giu.Label(fmt.Sprintf("Invalid lines: %d", getTraceInvalid())),
+			}, nil),
+			giu.MenuItem("Retry Now").Enabled(!strings.HasPrefix(status, "Connected")).OnClick(retryTraces),
+		)
+	}
+
 	return widgets
 }
 
-func buildProfileMenuItem(name, title string) *giu.MenuItemWidget {
+func buildAlertsBanner() {
+	// get firing alerts
+	firing := firingAlerts()
+	if len(firing) == 0 {
+		return
+	}
+
+	// draw banner
+	text := fmt.Sprintf("%d alert(s) firing: %s", len(firing), strings.Join(lo.Map(firing, func(rule *alertRule, _ int) string {
+		return rule.title()
+	}), ", "))
+	giu.Style().SetColor(giu.StyleColorText, color.RGBA{R: 240, G: 90, B: 90, A: 255}).To(
+		giu.MenuItem(text).OnClick(func() {
+			if alertsWindow == nil {
+				alertsWindow = &alertWindow{
+					open: true,
+				}
+			}
+		}),
+	).Build()
+}
+
+func buildProfileMenuItem(name, title, sample string) *giu.MenuItemWidget {
 	return giu.MenuItem(title).OnClick(func() {
 		if profileWindows[name] == nil {
 			profileWindows[name] = &profileWindow{
 				name:   name,
 				title:  title,
+				sample: sample,
 				open:   true,
 				stream: true,
 			}
@@ -253,6 +493,9 @@ func metricsLoader(url string) {
 			println("metrics: " + err.Error())
 		}
 
+		// evaluate alerts
+		evaluateAlerts()
+
 		// update
 		giu.Update()
 
@@ -262,35 +505,117 @@ func metricsLoader(url string) {
 }
 
 func traceLoader(url string) {
+	// prepare backoff
+	backoff := time.Second
+
 	for {
 		// load traces
-		err := loadTraces(url, func() {
+		setTraceStatus("Connecting...")
+		started := time.Now()
+		var delivered bool
+		connected, err := loadTraces(url, func() {
+			delivered = true
 			giu.Update()
 		})
+
+		// reset backoff if the connection delivered events or stayed up
+		if connected && (delivered || time.Since(started) >= traceStableTime) {
+			backoff = time.Second
+		}
+
+		// await manual retry if the endpoint is missing
+		if errors.Is(err, errTraceNotFound) {
+			setTraceStatus("Not found, retry manually")
+			giu.Update()
+			<-traceRetry
+			continue
+		}
+
+		// set status
 		if err != nil {
 			println("trace: " + err.Error())
+			setTraceStatus(fmt.Sprintf("Error: %s, retrying in %s", err, backoff))
+		} else {
+			setTraceStatus(fmt.Sprintf("Disconnected, retrying in %s", backoff))
+		}
+		giu.Update()
+
+		// await backoff or manual retry
+		select {
+		case <-time.After(backoff):
+		case <-traceRetry:
 		}
 
-		// debounce reconnect
-		time.Sleep(time.Second)
+		// increase backoff
+		backoff = min(backoff*2, time.Minute)
 	}
 }
 
-func profileLoader(name, sample, url string) {
+func traceMetricsLoader() {
+	// prepare last derivation
+	last := time.Now()
+
+	for {
+		// await next interval
+		time.Sleep(*scrapeInterval)
+
+		// derive metrics
+		now := time.Now()
+		deriveTraceMetrics(last, now)
+		last = now
+
+		// evaluate alerts
+		evaluateAlerts()
+	}
+}
+
+func profileLoader(name string, targets []string, path string, mode profileMode) {
+	// prepare last snapshots
+	var last []*profile.Profile
+
 	for {
 		// check window
 		if profileWindows[name] == nil {
+			last = nil
 			time.Sleep(*profileInterval)
 			continue
 		}
 
 		// load profile
-		err := loadProfile(name, sample, url, *profileInterval)
+		var err error
+		last, err = loadProfile(name, targets, path, *profileInterval, mode, last)
 		if err != nil {
 			println("profile: " + err.Error())
 		}
 
 		// update
 		giu.Update()
+
+		// await next interval if not sampled by the target
+		if mode != sampledProfile {
+			time.Sleep(*profileInterval)
+		}
+	}
+}
+
+func goroutineLoader(url string) {
+	for {
+		// check window
+		if goroutinesWindow == nil {
+			time.Sleep(*profileInterval)
+			continue
+		}
+
+		// load goroutines
+		err := loadGoroutines(url)
+		if err != nil {
+			println("goroutines: " + err.Error())
+		}
+
+		// update
+		giu.Update()
+
+		// await next interval
+		time.Sleep(*profileInterval)
 	}
 }
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"image/color"
+
 	"github.com/AllenDang/giu"
 	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
 )
 
 type metricWindow struct {
-	node  *metricsNode
-	cols  int32
-	inter bool
-	open  bool
+	node      *metricsNode
+	cols      int32
+	inter     bool
+	open      bool
+	threshold float32
+	window    int32
 }
 
 func (w *metricWindow) draw(m *giu.MasterWindow) {
 	// create window
-	win := newWindow(m, w.node.name).Flags(giu.WindowFlagsMenuBar).IsOpen(&w.open)
+	win := newWindow(m, w.node.title(), giu.WindowFlagsMenuBar).IsOpen(&w.open)
 
 	// get size
 	width, _ := win.CurrentSize()
@@ -47,8 +52,8 @@ func (w *metricWindow) draw(m *giu.MasterWindow) {
 				min -= r
 				max += r
 
-				// prepare plot flags
-				plotFlags := giu.PlotFlagsCrosshairs
+				// prepare plot flags, plot menus are replaced by the alert menu
+				plotFlags := giu.PlotFlagsCrosshairs | giu.PlotFlagsNoMenus
 				if len(s.dims) == 1 && s.dims[0] == "default" {
 					plotFlags |= giu.PlotFlagsNoLegend
 				}
@@ -75,8 +80,17 @@ func (w *metricWindow) draw(m *giu.MasterWindow) {
 					condition = giu.ConditionOnce
 				}
 
+				// check alerts
+				firing := alertFiring(s.name)
+
 				// append widget
 				widgets = append(widgets, giu.Custom(func() {
+					// highlight firing alerts
+					if firing {
+						giu.PushStyleColor(giu.StyleColorFrameBg, color.RGBA{R: 120, G: 40, B: 40, A: 255})
+					}
+
+					// draw plot
 					giu.Plot(s.name).
 						Size((int(width)-20-(int(w.cols)*8))/int(w.cols), 0).
 						AxisLimits(0, float64(*seriesLength), min, max, condition).
@@ -85,7 +99,26 @@ func (w *metricWindow) draw(m *giu.MasterWindow) {
 						YTicks(ticks, false, 0).
 						Flags(plotFlags).Plots(lines...).
 						Build()
+					if firing {
+						giu.PopStyleColor()
+					}
 					giu.Tooltip(s.help).Build()
+
+					// add alert menu
+					giu.ContextMenu().ID("alert-"+s.name).Layout(
+						giu.Label("Add Alert Rule"),
+						giu.InputFloat(&w.threshold).Label("Threshold"),
+						giu.SliderInt(&w.window, 1, int32(*seriesLength)-1).Label("Window"),
+						giu.MenuItem("Above Threshold").OnClick(func() {
+							w.addAlert(s.name, alertAbove)
+						}),
+						giu.MenuItem("Below Threshold").OnClick(func() {
+							w.addAlert(s.name, alertBelow)
+						}),
+						giu.MenuItem("Change Over Window").OnClick(func() {
+							w.addAlert(s.name, alertChange)
+						}),
+					).Build()
 				}))
 
 				// check row
@@ -102,3 +135,12 @@ func (w *metricWindow) draw(m *giu.MasterWindow) {
 		}),
 	)
 }
+
+func (w *metricWindow) addAlert(series, kind string) {
+	addAlert(&alertRule{
+		Series:    series,
+		Kind:      kind,
+		Threshold: float64(w.threshold),
+		Window:    lo.Ternary(kind == alertChange, int(w.window), 0),
+	})
+}
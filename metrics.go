@@ -125,8 +125,12 @@ func ingestMetric(family *dto.MetricFamily, metric *dto.Metric, splitDepth int)
 }
 
 func getList(name, help, dim string, splitDepth int) *list {
+	return ensureList(strings.SplitN(name, "_", splitDepth), name, help, dim)
+}
+
+func ensureList(path []string, name, help, dim string) *list {
 	// ensure node
-	node := metricsTree.ensure(strings.SplitN(name, "_", splitDepth))
+	node := metricsTree.ensure(path)
 
 	// ensure series
 	if node.series == nil {
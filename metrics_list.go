@@ -6,6 +6,7 @@ type list struct {
 	length    int
 	data      []float64
 	pos       int
+	count     int
 	hasLast   bool
 	lastValue float64
 	lastSum   float64
@@ -48,12 +49,21 @@ func (l *list) add(value float64) {
 	if l.pos >= l.length {
 		l.pos = 0
 	}
+
+	// increment count
+	if l.count < l.length {
+		l.count++
+	}
 }
 
 func (l *list) slice() []float64 {
 	return l.data[l.pos : l.length+l.pos]
 }
 
+func (l *list) recent() []float64 {
+	return l.data[l.length+l.pos-l.count : l.length+l.pos]
+}
+
 func minMax(lists ...[]float64) (float64, float64) {
 	// find minimum and maximum
 	min, max := lists[0][0], lists[0][0]
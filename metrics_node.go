@@ -1,6 +1,9 @@
 package main
 
-import "sort"
+import (
+	"sort"
+	"strings"
+)
 
 type metricsNode struct {
 	name     string
@@ -24,10 +27,8 @@ func (n *metricsNode) ensure(path []string) *metricsNode {
 
 func (n *metricsNode) push(name string) *metricsNode {
 	// check children
-	for _, child := range n.children {
-		if child.name == name {
-			return child
-		}
+	if child := n.child(name); child != nil {
+		return child
 	}
 
 	// create child
@@ -47,6 +48,57 @@ func (n *metricsNode) push(name string) *metricsNode {
 	return child
 }
 
+func (n *metricsNode) remove(path []string) {
+	// find node
+	node := n
+	for _, name := range path {
+		node = node.child(name)
+		if node == nil {
+			return
+		}
+	}
+
+	// remove node and the parents it leaves empty
+	for node != n {
+		parent := node.parent
+		for i, child := range parent.children {
+			if child == node {
+				parent.children = append(parent.children[:i], parent.children[i+1:]...)
+				break
+			}
+		}
+		if parent.series != nil || len(parent.children) > 0 {
+			break
+		}
+		node = parent
+	}
+}
+
+func (n *metricsNode) child(name string) *metricsNode {
+	// find child
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+func (n *metricsNode) path() []string {
+	// collect names up to the root
+	var path []string
+	for node := n; node.parent != nil; node = node.parent {
+		path = append([]string{node.name}, path...)
+	}
+
+	return path
+}
+
+func (n *metricsNode) title() string {
+	return strings.Join(n.path(), " / ")
+}
+
 func (n *metricsNode) walk(fn func(*metricsNode)) {
 	// emit self
 	fn(n)
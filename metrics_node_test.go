@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestMetricsNodeRemove(t *testing.T) {
+	// build tree
+	root := &metricsNode{name: "root"}
+	rate := root.ensure([]string{"trace", "api", "GET", "rate"})
+	rate.series = &metricSeries{name: "api:GET:rate"}
+	root.ensure([]string{"trace", "api", "POST", "rate"}).series = &metricSeries{name: "api:POST:rate"}
+	if title := rate.title(); title != "trace / api / GET / rate" {
+		t.Fatalf("got title %q", title)
+	}
+
+	// remove leaf, the emptied task is removed as well
+	root.remove([]string{"trace", "api", "GET", "rate"})
+	api := root.child("trace").child("api")
+	if len(api.children) != 1 || api.children[0].name != "POST" {
+		t.Fatalf("unexpected children: %v", api.children)
+	}
+
+	// remove missing path
+	root.remove([]string{"trace", "missing", "rate"})
+
+	// remove last leaf, all empty parents are removed
+	root.remove([]string{"trace", "api", "POST", "rate"})
+	if len(root.children) != 0 {
+		t.Fatalf("unexpected children: %v", root.children)
+	}
+}
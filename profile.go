@@ -1,29 +1,114 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/pprof/profile"
 )
 
-var profileNodes = map[string]*node{}
+type profileMode int
+
+const (
+	sampledProfile profileMode = iota
+	deltaProfile
+	snapshotProfile
+	fileProfile
+)
+
+var profiles = map[string]*profile.Profile{}
+var profileModes = map[string]profileMode{}
 var profilesMutex sync.Mutex
 
-func loadProfile(name, sample, url string, duration time.Duration) error {
-	// get seconds
-	seconds := int(duration / time.Second)
-	if seconds < 1 {
-		seconds = 1
+const targetLabel = "target"
+
+func loadProfile(name string, targets []string, path string, duration time.Duration, mode profileMode, last []*profile.Profile) ([]*profile.Profile, error) {
+	// fetch profiles concurrently
+	snapshots := make([]*profile.Profile, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			snapshots[i], errs[i] = fetchProfile(target+path, duration, mode)
+		}(i, target)
+	}
+	wg.Wait()
+
+	// collect results
+	results := make([]*profile.Profile, 0, len(targets))
+	for i, prf := range snapshots {
+		// check profile
+		if prf == nil {
+			continue
+		}
+
+		// compute delta to last snapshot
+		if mode == deltaProfile {
+			// skip first snapshot
+			if i >= len(last) || last[i] == nil {
+				continue
+			}
+
+			// compute delta
+			var err error
+			prf, err = diffProfiles(last[i], prf, true)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+
+		// label samples with target
+		if len(targets) > 1 {
+			for _, sample := range prf.Sample {
+				if sample.Label == nil {
+					sample.Label = map[string][]string{}
+				}
+				sample.Label[targetLabel] = []string{targets[i]}
+			}
+		}
+
+		// add result
+		results = append(results, prf)
+	}
+
+	// merge and set profile
+	if len(results) > 0 {
+		result, err := profile.Merge(results)
+		if err != nil {
+			return snapshots, err
+		}
+		result.TimeNanos = results[0].TimeNanos
+		result.DurationNanos = results[0].DurationNanos
+		setProfile(name, result, mode)
+	}
+
+	return snapshots, errors.Join(errs...)
+}
+
+func fetchProfile(url string, duration time.Duration, mode profileMode) (*profile.Profile, error) {
+	// add seconds if sampled by the target
+	if mode == sampledProfile {
+		seconds := int(duration / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		url += "?seconds=" + strconv.Itoa(seconds)
 	}
 
 	// get profile
-	res, err := http.Get(url + "?seconds=" + strconv.Itoa(seconds))
+	res, err := http.Get(url)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// ensure close
@@ -32,75 +117,155 @@ func loadProfile(name, sample, url string, duration time.Duration) error {
 	// parse profile
 	prf, err := profile.Parse(res.Body)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%s: %w", url, err)
 	}
 
-	// prepare root
-	root := &node{
-		name: "root",
-	}
+	return prf, nil
+}
 
-	// get sample index
-	sampleIndex := -1
-	for i, st := range prf.SampleType {
-		if st.Type == sample {
-			sampleIndex = i
+func openProfiles(name string, files []string, base string) error {
+	// read profiles
+	prfs := make([]*profile.Profile, 0, len(files))
+	for _, file := range files {
+		prf, err := readProfile(file)
+		if err != nil {
+			return err
 		}
+		prfs = append(prfs, prf)
 	}
-	if sampleIndex < 0 {
-		return fmt.Errorf("sample not found")
+
+	// merge profiles
+	prf, err := profile.Merge(prfs)
+	if err != nil {
+		return err
 	}
 
-	// convert samples
-	for _, sample := range prf.Sample {
-		// prepare node
-		node := root
+	// subtract base
+	if base != "" {
+		baseProfile, err := readProfile(base)
+		if err != nil {
+			return err
+		}
+		prf, err = diffProfiles(baseProfile, prf, false)
+		if err != nil {
+			return err
+		}
+	}
 
-		// reverse iterate locations
-		for i := len(sample.Location) - 1; i >= 0; i-- {
-			// get location
-			location := sample.Location[i]
+	// set profile
+	setProfile(name, prf, fileProfile)
 
-			// iterate lines
-			for _, line := range location.Line {
-				node = node.push(line.Function.Name)
-			}
-		}
+	return nil
+}
+
+func readProfile(file string) (*profile.Profile, error) {
+	// open file
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
 
-		// set self
-		node.self += sample.Value[sampleIndex]
+	// ensure close
+	defer f.Close()
 
-		// increment total
-		for node != nil {
-			node.total += sample.Value[sampleIndex]
-			node = node.parent
-		}
+	// parse profile
+	prf, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
 	}
 
-	// sort nodes
-	root.sort()
+	return prf, nil
+}
 
-	// set profile
+func setProfile(name string, prf *profile.Profile, mode profileMode) {
+	// acquire mutex
 	profilesMutex.Lock()
-	profileNodes[name] = root
-	profilesMutex.Unlock()
+	defer profilesMutex.Unlock()
 
-	return nil
+	// set profile
+	profiles[name] = prf
+	profileModes[name] = mode
 }
 
-func getProfile(name string) *node {
+func getProfile(name string) (*profile.Profile, profileMode) {
 	// acquire mutex
 	profilesMutex.Lock()
 	defer profilesMutex.Unlock()
 
-	return profileNodes[name]
+	return profiles[name], profileModes[name]
 }
 
-type walkProfileFunc func(level int, offset, length float32, name string, self, total int64)
+func diffProfiles(base, prf *profile.Profile, cumulative bool) (*profile.Profile, error) {
+	// get ratios, gauges like in-use memory are kept as a snapshot if only
+	// cumulative values should be subtracted
+	ratios := make([]float64, len(base.SampleType))
+	for i, st := range base.SampleType {
+		ratios[i] = -1
+		if cumulative && strings.HasPrefix(st.Type, "inuse_") {
+			ratios[i] = 0
+		}
+	}
+
+	// negate base
+	base = base.Copy()
+	err := base.ScaleN(ratios)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge profiles
+	delta, err := profile.Merge([]*profile.Profile{base, prf})
+	if err != nil {
+		return nil, err
+	}
+
+	// set time and duration
+	delta.TimeNanos = prf.TimeNanos
+	delta.DurationNanos = prf.TimeNanos - base.TimeNanos
+
+	return delta, nil
+}
+
+func findSample(prf *profile.Profile, sample string) int {
+	// find sample index
+	for i, st := range prf.SampleType {
+		if st.Type == sample {
+			return i
+		}
+	}
+
+	// otherwise use last sample like pprof
+	return len(prf.SampleType) - 1
+}
+
+type profileGranularity int
+
+const (
+	functionGranularity profileGranularity = iota
+	lineGranularity
+	fileGranularity
+	addressGranularity
+)
+
+var profileGranularities = []string{"Functions", "Lines", "Files", "Addresses"}
+
+// profileSamples lists the sample types of the profiles fetched from a target,
+// opened files may use any sample type.
+var profileSamples = map[string][]string{
+	"cpu":          {"samples", "cpu"},
+	"allocs":       {"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"},
+	"heap":         {"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"},
+	"block":        {"contentions", "delay"},
+	"mutex":        {"contentions", "delay"},
+	"goroutine":    {"goroutine"},
+	"threadcreate": {"threadcreate"},
+}
+
+type walkProfileFunc func(level int, offset, length float32, node *node)
 
 func walkProfile(node *node, fn walkProfileFunc) {
 	// get divisor
-	divisor := float32(node.total)
+	divisor := float32(node.weight)
 
 	// walk node
 	walkProfileNode(node, 0, 0, divisor, fn)
@@ -108,10 +273,10 @@ func walkProfile(node *node, fn walkProfileFunc) {
 
 func walkProfileNode(nd *node, level int, offset, divisor float32, fn walkProfileFunc) float32 {
 	// get length
-	length := float32(nd.total) / divisor
+	length := float32(nd.weight) / divisor
 
 	// emit node
-	fn(level, offset, length, nd.name, nd.self, nd.total)
+	fn(level, offset, length, nd)
 
 	// walk children
 	for _, node := range nd.nodes {
@@ -120,3 +285,18 @@ func walkProfileNode(nd *node, level int, offset, divisor float32, fn walkProfil
 
 	return length
 }
+
+func matchProfile(nd *node, re *regexp.Regexp) int64 {
+	// check node
+	if re.MatchString(nd.name) {
+		return nd.total
+	}
+
+	// sum children
+	var total int64
+	for _, node := range nd.nodes {
+		total += matchProfile(node, re)
+	}
+
+	return total
+}
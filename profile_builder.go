@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+const profileChildScan = 8
+
+type profileFrame struct {
+	name string
+	fn   string
+	file string
+	line int64
+}
+
+type profileChild struct {
+	parent *node
+	frame  uint32
+}
+
+type profileBuilder struct {
+	ids      map[profileFrame]uint32
+	frames   []profileFrame
+	stacks   map[*profile.Location][]uint32
+	children map[profileChild]*node
+	targets  []string
+	arena    nodeArena
+}
+
+func newProfileBuilder() *profileBuilder {
+	return &profileBuilder{
+		ids:      map[profileFrame]uint32{},
+		stacks:   map[*profile.Location][]uint32{},
+		children: map[profileChild]*node{},
+	}
+}
+
+func (b *profileBuilder) build(prf *profile.Profile, sampleIndex int, granularity profileGranularity) *node {
+	// reset state, previously built trees are invalidated
+	clear(b.ids)
+	clear(b.stacks)
+	clear(b.children)
+	b.frames = b.frames[:0]
+	b.targets = b.targets[:0]
+	b.arena.reset()
+
+	// prepare root
+	root := b.arena.alloc()
+	root.name = "root"
+
+	// convert samples
+	for _, sample := range prf.Sample {
+		// prepare node
+		node := root
+
+		// reverse iterate locations
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			for _, frame := range b.stack(sample.Location[i], granularity) {
+				node = b.child(node, frame)
+			}
+		}
+
+		// get value and weight
+		value := sample.Value[sampleIndex]
+		weight := value
+		if weight < 0 {
+			weight = -weight
+		}
+
+		// get target
+		target := -1
+		if values := sample.Label[targetLabel]; len(values) > 0 {
+			target = b.target(values[0])
+		}
+
+		// set self
+		node.self += value
+
+		// increment total, weight and target part
+		for node != nil {
+			node.total += value
+			node.weight += weight
+			if target >= 0 {
+				for len(node.parts) <= target {
+					node.parts = append(node.parts, 0)
+				}
+				node.parts[target] += value
+			}
+			node = node.parent
+		}
+	}
+
+	// sort nodes
+	root.sort()
+
+	return root
+}
+
+func (b *profileBuilder) stack(location *profile.Location, granularity profileGranularity) []uint32 {
+	// check cache
+	frames, ok := b.stacks[location]
+	if ok {
+		return frames
+	}
+
+	// handle unsymbolized locations
+	if len(location.Line) == 0 {
+		if granularity == addressGranularity {
+			frames = append(frames, b.intern(profileFrame{
+				name: fmt.Sprintf("0x%x", location.Address),
+			}))
+		}
+		b.stacks[location] = frames
+		return frames
+	}
+
+	// reverse iterate lines (callers are last)
+	for j := len(location.Line) - 1; j >= 0; j-- {
+		// get function
+		fn := location.Line[j].Function
+		if fn == nil {
+			continue
+		}
+
+		// get frame
+		var frame profileFrame
+		switch granularity {
+		case functionGranularity:
+			frame = profileFrame{name: fn.Name, fn: fn.Name, file: fn.Filename, line: fn.StartLine}
+		case lineGranularity:
+			frame = profileFrame{name: fmt.Sprintf("%s:%d", fn.Name, location.Line[j].Line), fn: fn.Name, file: fn.Filename, line: location.Line[j].Line}
+		case fileGranularity:
+			frame = profileFrame{name: fn.Filename, file: fn.Filename}
+		case addressGranularity:
+			frame = profileFrame{name: fmt.Sprintf("0x%x %s", location.Address, fn.Name), fn: fn.Name, file: fn.Filename, line: location.Line[j].Line}
+		}
+
+		// add frame
+		frames = append(frames, b.intern(frame))
+	}
+
+	// cache frames
+	b.stacks[location] = frames
+
+	return frames
+}
+
+func (b *profileBuilder) intern(frame profileFrame) uint32 {
+	// check frame
+	id, ok := b.ids[frame]
+	if ok {
+		return id
+	}
+
+	// add frame
+	id = uint32(len(b.frames))
+	b.frames = append(b.frames, frame)
+	b.ids[frame] = id
+
+	return id
+}
+
+func (b *profileBuilder) target(name string) int {
+	// find target
+	for i, target := range b.targets {
+		if target == name {
+			return i
+		}
+	}
+
+	// add target
+	b.targets = append(b.targets, name)
+
+	return len(b.targets) - 1
+}
+
+func (b *profileBuilder) child(parent *node, frame uint32) *node {
+	// scan short child lists, longer ones are indexed
+	if len(parent.nodes) <= profileChildScan {
+		for _, child := range parent.nodes {
+			if child.frame == frame {
+				return child
+			}
+		}
+	} else if child, ok := b.children[profileChild{parent: parent, frame: frame}]; ok {
+		return child
+	}
+
+	// create child
+	info := b.frames[frame]
+	child := b.arena.alloc()
+	child.name = info.name
+	child.fn = info.fn
+	child.file = info.file
+	child.line = info.line
+	child.frame = frame
+	child.parent = parent
+
+	// add child
+	parent.nodes = append(parent.nodes, child)
+
+	// index children once the list gets too long to scan
+	if len(parent.nodes) == profileChildScan+1 {
+		for _, node := range parent.nodes {
+			b.children[profileChild{parent: parent, frame: node.frame}] = node
+		}
+	} else if len(parent.nodes) > profileChildScan+1 {
+		b.children[profileChild{parent: parent, frame: frame}] = child
+	}
+
+	return child
+}
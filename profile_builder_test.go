@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func generateProfile(samples int) *profile.Profile {
+	// prepare random source
+	rnd := rand.New(rand.NewSource(1))
+
+	// prepare profile
+	prf := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+	}
+
+	// create functions
+	for i := 0; i < 2000; i++ {
+		prf.Function = append(prf.Function, &profile.Function{
+			ID:        uint64(i + 1),
+			Name:      fmt.Sprintf("github.com/example/pkg%d.fn%d", i%50, i),
+			Filename:  fmt.Sprintf("/src/pkg%d/file%d.go", i%50, i%200),
+			StartLine: int64(10 + i%300),
+		})
+	}
+
+	// create locations, some with inlined functions
+	for i := 0; i < 10000; i++ {
+		location := &profile.Location{
+			ID:      uint64(i + 1),
+			Address: uint64(0x400000 + i*16),
+		}
+		for j := 0; j < 1+rnd.Intn(3)/2; j++ {
+			fn := prf.Function[rnd.Intn(len(prf.Function))]
+			location.Line = append(location.Line, profile.Line{
+				Function: fn,
+				Line:     fn.StartLine + int64(rnd.Intn(40)),
+			})
+		}
+		if i%500 == 0 {
+			location.Line = nil
+		}
+		prf.Location = append(prf.Location, location)
+	}
+
+	// create call paths shared by many samples
+	paths := make([][]*profile.Location, 5000)
+	for i := range paths {
+		depth := 5 + rnd.Intn(25)
+		for j := 0; j < depth; j++ {
+			paths[i] = append(paths[i], prf.Location[rnd.Intn(len(prf.Location))])
+		}
+	}
+
+	// create samples
+	for i := 0; i < samples; i++ {
+		count := int64(1 + rnd.Intn(5))
+		prf.Sample = append(prf.Sample, &profile.Sample{
+			Location: paths[rnd.Intn(len(paths))],
+			Value:    []int64{count, count * 10000000},
+		})
+	}
+
+	return prf
+}
+
+func pushNode(n *node, name, fn, file string, line int64) *node {
+	// check nodes
+	for _, node := range n.nodes {
+		if node.name == name {
+			return node
+		}
+	}
+
+	// create node
+	node := &node{
+		name:   name,
+		fn:     fn,
+		file:   file,
+		line:   line,
+		parent: n,
+	}
+
+	// add node
+	n.nodes = append(n.nodes, node)
+
+	return node
+}
+
+func pushProfile(prf *profile.Profile, sampleIndex int, granularity profileGranularity) *node {
+	// prepare root
+	root := &node{
+		name: "root",
+	}
+
+	// convert samples
+	for _, sample := range prf.Sample {
+		// prepare node
+		node := root
+
+		// reverse iterate locations
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			// get location
+			location := sample.Location[i]
+
+			// handle unsymbolized locations
+			if len(location.Line) == 0 {
+				if granularity == addressGranularity {
+					node = pushNode(node, fmt.Sprintf("0x%x", location.Address), "", "", 0)
+				}
+				continue
+			}
+
+			// reverse iterate lines (callers are last)
+			for j := len(location.Line) - 1; j >= 0; j-- {
+				// get line
+				line := location.Line[j]
+				if line.Function == nil {
+					continue
+				}
+
+				// push frame
+				switch granularity {
+				case functionGranularity:
+					node = pushNode(node, line.Function.Name, line.Function.Name, line.Function.Filename, line.Function.StartLine)
+				case lineGranularity:
+					node = pushNode(node, fmt.Sprintf("%s:%d", line.Function.Name, line.Line), line.Function.Name, line.Function.Filename, line.Line)
+				case fileGranularity:
+					node = pushNode(node, line.Function.Filename, "", line.Function.Filename, 0)
+				case addressGranularity:
+					node = pushNode(node, fmt.Sprintf("0x%x %s", location.Address, line.Function.Name), line.Function.Name, line.Function.Filename, line.Line)
+				}
+			}
+		}
+
+		// get value and weight
+		value := sample.Value[sampleIndex]
+		weight := value
+		if weight < 0 {
+			weight = -weight
+		}
+
+		// set self
+		node.self += value
+
+		// increment total and weight
+		for node != nil {
+			node.total += value
+			node.weight += weight
+			node = node.parent
+		}
+	}
+
+	// sort nodes
+	root.sort()
+
+	return root
+}
+
+func compareNodes(t *testing.T, path string, a, b *node) {
+	// check values
+	path += "/" + a.name
+	if a.name != b.name || a.self != b.self || a.total != b.total || a.weight != b.weight {
+		t.Fatalf("%s: got %s %d/%d/%d, want %s %d/%d/%d", path, a.name, a.self, a.total, a.weight, b.name, b.self, b.total, b.weight)
+	}
+
+	// check children
+	if len(a.nodes) != len(b.nodes) {
+		t.Fatalf("%s: got %d children, want %d", path, len(a.nodes), len(b.nodes))
+	}
+	for i := range a.nodes {
+		compareNodes(t, path, a.nodes[i], b.nodes[i])
+	}
+}
+
+func TestProfileBuilder(t *testing.T) {
+	prf := generateProfile(10000)
+	builder := newProfileBuilder()
+	for granularity := range profileGranularities {
+		t.Run(profileGranularities[granularity], func(t *testing.T) {
+			// build twice to check that reused state is reset
+			for i := 0; i < 2; i++ {
+				root := builder.build(prf, 1, profileGranularity(granularity))
+				compareNodes(t, "", root, pushProfile(prf, 1, profileGranularity(granularity)))
+			}
+		})
+	}
+}
+
+func BenchmarkProfileBuilder(b *testing.B) {
+	prf := generateProfile(100000)
+	for granularity := range profileGranularities {
+		b.Run(profileGranularities[granularity], func(b *testing.B) {
+			builder := newProfileBuilder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				builder.build(prf, 1, profileGranularity(granularity))
+			}
+		})
+	}
+}
+
+func BenchmarkProfilePush(b *testing.B) {
+	prf := generateProfile(100000)
+	for granularity := range profileGranularities {
+		b.Run(profileGranularities[granularity], func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pushProfile(prf, 1, profileGranularity(granularity))
+			}
+		})
+	}
+}
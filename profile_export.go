@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+const svgWidth = 1200
+const svgRowHeight = 18
+const svgCharWidth = 7
+
+func exportPath(name, ext string) string {
+	return filepath.Join(*exportDir, name+"-"+time.Now().Format("20060102-150405")+ext)
+}
+
+func exportProfile(path string, prf *profile.Profile) error {
+	return writeFile(path, func(w io.Writer) error {
+		return prf.Write(w)
+	})
+}
+
+func exportFolded(path string, root *node) error {
+	return writeFile(path, func(w io.Writer) error {
+		return writeFolded(w, root)
+	})
+}
+
+func exportFlameGraph(path, title, unit string, root *node) error {
+	return writeFile(path, func(w io.Writer) error {
+		return writeFlameGraph(w, title, unit, root)
+	})
+}
+
+func writeFile(path string, fn func(io.Writer) error) error {
+	// create file
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// ensure close
+	defer file.Close()
+
+	// write data
+	buf := bufio.NewWriter(file)
+	err = fn(buf)
+	if err != nil {
+		return err
+	}
+
+	// flush data
+	err = buf.Flush()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeFolded(w io.Writer, root *node) error {
+	// prepare stack
+	var stack []string
+
+	// walk tree
+	var walk func(*node) error
+	walk = func(nd *node) error {
+		// push frame
+		stack = append(stack, strings.ReplaceAll(nd.name, ";", ":"))
+		defer func() {
+			stack = stack[:len(stack)-1]
+		}()
+
+		// write self
+		if nd.self != 0 {
+			_, err := fmt.Fprintf(w, "%s %d\n", strings.Join(stack, ";"), nd.self)
+			if err != nil {
+				return err
+			}
+		}
+
+		// walk children
+		for _, child := range nd.nodes {
+			err := walk(child)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// walk children of root
+	for _, child := range root.nodes {
+		err := walk(child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFlameGraph(w io.Writer, title, unit string, root *node) error {
+	// determine depth
+	var depth int
+	walkProfile(root, func(level int, _, _ float32, _ *node) {
+		if level > depth {
+			depth = level
+		}
+	})
+
+	// get height
+	height := (depth+1)*svgRowHeight + 40
+
+	// write header
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg" font-family="Verdana, sans-serif" font-size="12">
+<rect x="0" y="0" width="%d" height="%d" fill="#ffffff"/>
+<text x="%d" y="20" text-anchor="middle" font-size="16">%s</text>
+`, svgWidth, height, svgWidth, height, svgWidth/2, html.EscapeString(title))
+	if err != nil {
+		return err
+	}
+
+	// write frames
+	walkProfile(root, func(level int, offset, length float32, nd *node) {
+		// get geometry
+		x := float64(offset) * svgWidth
+		y := 30 + level*svgRowHeight
+		width := float64(length) * svgWidth
+		if width < 0.1 || err != nil {
+			return
+		}
+
+		// get label, shares are omitted for diffs without a positive total
+		label := fmt.Sprintf("%s (%s)", nd.name, fmtValue(nd.total, unit))
+		if root.total > 0 {
+			label = fmt.Sprintf("%s (%s, %.2f%%)", nd.name, fmtValue(nd.total, unit), float64(nd.total)/float64(root.total)*100)
+		}
+
+		// get visible text
+		text := nd.name
+		chars := int(width-6) / svgCharWidth
+		if chars < 3 {
+			text = ""
+		} else if runes := []rune(text); len(runes) > chars {
+			text = string(runes[:chars-2]) + ".."
+		}
+
+		// write frame
+		_, err = fmt.Fprintf(w, `<g><title>%s</title><rect x="%.2f" y="%d" width="%.2f" height="%d" fill="%s" rx="2"/><text x="%.2f" y="%d">%s</text></g>
+`, html.EscapeString(label), x, y, width, svgRowHeight-1, flameColor(nd.name), x+3, y+13, html.EscapeString(text))
+	})
+	if err != nil {
+		return err
+	}
+
+	// write footer
+	_, err = io.WriteString(w, "</svg>\n")
+
+	return err
+}
+
+func flameColor(name string) string {
+	// hash name
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+	v := hash.Sum32()
+
+	// derive warm color
+	r := 205 + v%50
+	g := (v >> 8) % 230
+	b := (v >> 16) % 55
+
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, b)
+}
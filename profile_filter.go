@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/google/pprof/profile"
+)
+
+var runtimeEntries = regexp.MustCompile(`^runtime\.(goexit|goexit0|goexit1|mcall|mstart|mstart0|mstart1|systemstack|morestack|main)$`)
+var runtimeFrames = regexp.MustCompile(`^runtime\.`)
+
+type profileFilter struct {
+	focus  string
+	ignore string
+	hide   string
+	show   string
+	prune  bool
+	tag    string
+	value  string
+}
+
+func (f *profileFilter) active() bool {
+	return f.focus != "" || f.ignore != "" || f.hide != "" || f.show != "" || f.prune || f.tagged()
+}
+
+func (f *profileFilter) tagged() bool {
+	return f.tag != "" && f.value != ""
+}
+
+func (f *profileFilter) apply(prf *profile.Profile) (*profile.Profile, error) {
+	// compile expressions
+	focus, err := compileFilter(f.focus)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := compileFilter(f.ignore)
+	if err != nil {
+		return nil, err
+	}
+	hide, err := compileFilter(f.hide)
+	if err != nil {
+		return nil, err
+	}
+	show, err := compileFilter(f.show)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy profile
+	prf = prf.Copy()
+
+	// filter samples
+	if focus != nil || ignore != nil || hide != nil || show != nil {
+		prf.FilterSamplesByName(focus, ignore, hide, show)
+	}
+
+	// filter tag
+	if f.tagged() {
+		filterProfileTag(prf, f.tag, f.value)
+	}
+
+	// prune runtime
+	if f.prune {
+		prf.FilterSamplesByName(nil, nil, runtimeEntries, nil)
+		prf.Prune(runtimeFrames, nil)
+	}
+
+	return prf, nil
+}
+
+func compileFilter(expr string) (*regexp.Regexp, error) {
+	// check expression
+	if expr == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(expr)
+}
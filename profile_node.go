@@ -1,33 +1,38 @@
 package main
 
-import "sort"
+import (
+	"fmt"
+	"sort"
+)
+
+const nodeChunkSize = 4096
 
 type node struct {
 	name   string
+	fn     string
+	file   string
+	line   int64
+	frame  uint32
 	self   int64
 	total  int64
+	weight int64
+	parts  []int64
 	parent *node
 	nodes  []*node
 }
 
-func (n *node) push(name string) *node {
-	// check nodes
-	for _, node := range n.nodes {
-		if node.name == name {
-			return node
-		}
+func (n *node) location() string {
+	// check file
+	if n.file == "" {
+		return ""
 	}
 
-	// create node
-	node := &node{
-		name:   name,
-		parent: n,
+	// check line
+	if n.line == 0 {
+		return n.file
 	}
 
-	// add node
-	n.nodes = append(n.nodes, node)
-
-	return node
+	return fmt.Sprintf("%s:%d", n.file, n.line)
 }
 
 func (n *node) sort() {
@@ -41,3 +46,35 @@ func (n *node) sort() {
 		node.sort()
 	}
 }
+
+type nodeArena struct {
+	chunks [][]node
+	chunk  int
+	pos    int
+}
+
+func (a *nodeArena) alloc() *node {
+	// ensure chunk
+	if a.chunk == len(a.chunks) {
+		a.chunks = append(a.chunks, make([]node, nodeChunkSize))
+	}
+
+	// get node and reuse slices
+	n := &a.chunks[a.chunk][a.pos]
+	*n = node{nodes: n.nodes[:0], parts: n.parts[:0]}
+
+	// advance position
+	a.pos++
+	if a.pos == nodeChunkSize {
+		a.chunk++
+		a.pos = 0
+	}
+
+	return n
+}
+
+func (a *nodeArena) reset() {
+	// rewind to first chunk
+	a.chunk = 0
+	a.pos = 0
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/google/pprof/profile"
+)
+
+var sourceFiles = map[string][]string{}
+
+type sourceLine struct {
+	number int64
+	text   string
+	flat   int64
+	cum    int64
+}
+
+func sourceRoots() []string {
+	// collect configured roots
+	var roots []string
+	if *sourceRoot != "" {
+		roots = append(roots, filepath.SplitList(*sourceRoot)...)
+	}
+
+	// add GOROOT
+	goRoot := os.Getenv("GOROOT")
+	if goRoot == "" {
+		goRoot = runtime.GOROOT()
+	}
+	if goRoot != "" {
+		roots = append(roots, filepath.Join(goRoot, "src"))
+	}
+
+	// add module cache
+	modCache := os.Getenv("GOMODCACHE")
+	if modCache == "" {
+		goPath := os.Getenv("GOPATH")
+		if goPath == "" {
+			home, _ := os.UserHomeDir()
+			goPath = filepath.Join(home, "go")
+		}
+		modCache = filepath.Join(filepath.SplitList(goPath)[0], "pkg", "mod")
+	}
+	roots = append(roots, modCache)
+
+	return roots
+}
+
+func findSource(file string) string {
+	// check file
+	if file == "" {
+		return ""
+	}
+
+	// check absolute path
+	if filepath.IsAbs(file) {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+
+	// try all suffixes in all roots
+	parts := strings.Split(filepath.ToSlash(file), "/")
+	for _, root := range sourceRoots() {
+		for i := range parts {
+			suffix := filepath.Join(parts[i:]...)
+			for _, candidate := range []string{suffix, escapeModulePath(suffix)} {
+				path := filepath.Join(root, candidate)
+				if _, err := os.Stat(path); err == nil {
+					return path
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func escapeModulePath(path string) string {
+	// escape upper case letters like the module cache
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func readSource(file string) []string {
+	// check cache
+	lines, ok := sourceFiles[file]
+	if ok {
+		return lines
+	}
+
+	// read file
+	path := findSource(file)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+	}
+
+	// cache lines
+	sourceFiles[file] = lines
+
+	return lines
+}
+
+func annotateSource(prf *profile.Profile, sampleIndex int, fn, file string) []sourceLine {
+	// read source
+	text := readSource(file)
+	if text == nil {
+		return nil
+	}
+
+	// prepare values
+	flat := map[int64]int64{}
+	cum := map[int64]int64{}
+	var first, last int64
+
+	// collect values
+	for _, sample := range prf.Sample {
+		value := sample.Value[sampleIndex]
+		seen := map[int64]bool{}
+		for i, location := range sample.Location {
+			for j, line := range location.Line {
+				// check function
+				if line.Function == nil || line.Function.Filename != file || line.Line <= 0 {
+					continue
+				} else if fn != "" && line.Function.Name != fn {
+					continue
+				}
+
+				// track range
+				start := line.Function.StartLine
+				if start <= 0 || start > line.Line {
+					start = line.Line
+				}
+				if first == 0 || start < first {
+					first = start
+				}
+				if line.Line > last {
+					last = line.Line
+				}
+
+				// add flat if leaf
+				if i == 0 && j == 0 {
+					flat[line.Line] += value
+				}
+
+				// add cum once per sample
+				if !seen[line.Line] {
+					cum[line.Line] += value
+					seen[line.Line] = true
+				}
+			}
+		}
+	}
+
+	// show whole file if not limited to a function
+	if fn == "" || first == 0 {
+		first, last = 1, int64(len(text))
+	}
+
+	// add context
+	last += 2
+	if last > int64(len(text)) {
+		last = int64(len(text))
+	}
+
+	// check range
+	if first > last {
+		return nil
+	}
+
+	// prepare lines
+	lines := make([]sourceLine, 0, last-first+1)
+	for number := first; number <= last; number++ {
+		lines = append(lines, sourceLine{
+			number: number,
+			text:   text[number-1],
+			flat:   flat[number],
+			cum:    cum[number],
+		})
+	}
+
+	return lines
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/google/pprof/profile"
+)
+
+const noTag = "(none)"
+
+type tagTotal struct {
+	value string
+	total int64
+}
+
+func profileTagKeys(prf *profile.Profile) []string {
+	// collect keys
+	keys := map[string]bool{}
+	for _, sample := range prf.Sample {
+		for key := range sample.Label {
+			keys[key] = true
+		}
+		for key := range sample.NumLabel {
+			keys[key] = true
+		}
+	}
+
+	// sort keys
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func sampleTagValues(sample *profile.Sample, key string) []string {
+	// get string values
+	if values, ok := sample.Label[key]; ok {
+		return values
+	}
+
+	// get numeric values
+	numbers := sample.NumLabel[key]
+	if len(numbers) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(numbers))
+	for i, number := range numbers {
+		value := strconv.FormatInt(number, 10)
+		if units := sample.NumUnit[key]; i < len(units) && units[i] != "" {
+			value += " " + units[i]
+		}
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func profileTagTotals(prf *profile.Profile, sampleIndex int, key string) []tagTotal {
+	// sum values
+	totals := map[string]int64{}
+	for _, sample := range prf.Sample {
+		values := sampleTagValues(sample, key)
+		if len(values) == 0 {
+			values = []string{noTag}
+		}
+		for _, value := range values {
+			totals[value] += sample.Value[sampleIndex]
+		}
+	}
+
+	// sort totals
+	sorted := make([]tagTotal, 0, len(totals))
+	for value, total := range totals {
+		sorted = append(sorted, tagTotal{value: value, total: total})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].total != sorted[j].total {
+			return sorted[i].total > sorted[j].total
+		}
+		return sorted[i].value < sorted[j].value
+	})
+
+	return sorted
+}
+
+func filterProfileTag(prf *profile.Profile, key, value string) {
+	// filter samples
+	samples := prf.Sample[:0]
+	for _, sample := range prf.Sample {
+		values := sampleTagValues(sample, key)
+		if len(values) == 0 {
+			values = []string{noTag}
+		}
+		for _, v := range values {
+			if v == value {
+				samples = append(samples, sample)
+				break
+			}
+		}
+	}
+	prf.Sample = samples
+}
@@ -4,35 +4,157 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/AllenDang/giu"
+	"github.com/google/pprof/profile"
+	"github.com/samber/lo"
 )
 
 type profileWindow struct {
 	name    string
 	title   string
+	sample  string
 	open    bool
 	stream  bool
+	mode    profileMode
+	raw     *profile.Profile
+	view    *profile.Profile
+	filter  profileFilter
+	invalid error
+	tags    []string
+	totals  []tagTotal
+	pivot   bool
+	index   int32
+	gran    int32
+	search  string
+	match   *regexp.Regexp
+	matched int64
+	builder *profileBuilder
 	profile *node
+	srcFn   string
+	srcFile string
+	source  []sourceLine
+	status  string
 }
 
 func (w *profileWindow) update() {
-	// update profile
-	if w.stream {
-		w.profile = getProfile(w.name)
+	// check stream
+	if !w.stream {
+		return
 	}
+
+	// get profile
+	prf, mode := getProfile(w.name)
+	if prf == nil || prf == w.raw {
+		return
+	}
+
+	// set profile
+	w.raw = prf
+	w.mode = mode
+	w.index = int32(findSample(prf, w.sample))
+	w.tags = profileTagKeys(prf)
+
+	// rebuild tree
+	w.rebuild()
+}
+
+func (w *profileWindow) rebuild() {
+	// check profile
+	if w.raw == nil || w.index < 0 {
+		w.view = nil
+		w.profile = nil
+		return
+	}
+
+	// apply filter
+	w.view = w.raw
+	w.invalid = nil
+	if w.filter.active() {
+		view, err := w.filter.apply(w.raw)
+		if err != nil {
+			w.invalid = err
+		} else {
+			w.view = view
+		}
+	}
+
+	// build tree
+	if w.builder == nil {
+		w.builder = newProfileBuilder()
+	}
+	w.profile = w.builder.build(w.view, int(w.index), profileGranularity(w.gran))
+
+	// sum tag values
+	w.totals = nil
+	if w.filter.tag != "" {
+		w.totals = profileTagTotals(w.raw, int(w.index), w.filter.tag)
+	}
+
+	// update search
+	w.find()
+
+	// annotate source
+	w.annotate()
+}
+
+func (w *profileWindow) find() {
+	// check search
+	if w.search == "" {
+		w.match = nil
+		w.matched = 0
+		return
+	}
+
+	// compile search, fallback to literal match
+	match, err := regexp.Compile(w.search)
+	if err != nil {
+		match = regexp.MustCompile(regexp.QuoteMeta(w.search))
+	}
+
+	// set match
+	w.match = match
+	w.matched = 0
+	if w.profile != nil {
+		w.matched = matchProfile(w.profile, match)
+	}
+}
+
+func (w *profileWindow) annotate() {
+	// check selection
+	if w.srcFile == "" || w.view == nil || w.index < 0 {
+		w.source = nil
+		return
+	}
+
+	// annotate source
+	w.source = annotateSource(w.view, int(w.index), w.srcFn, w.srcFile)
 }
 
 func (w *profileWindow) draw(mw *giu.MasterWindow) {
 	// create window
-	win := newWindow(mw, w.title).Flags(giu.WindowFlagsMenuBar).IsOpen(&w.open)
+	win := newWindow(mw, w.title, giu.WindowFlagsMenuBar).IsOpen(&w.open)
 
-	// get position and size
-	width, _ := win.CurrentSize()
-	posX := 10
-	posY := 50
-	width -= 30
+	// get sample types
+	var samples []string
+	var unit string
+	if w.raw != nil {
+		samples = lo.Map(w.raw.SampleType, func(st *profile.ValueType, _ int) string {
+			return st.Type
+		})
+		if w.index >= 0 && int(w.index) < len(w.raw.SampleType) {
+			unit = w.raw.SampleType[w.index].Unit
+		}
+	}
+
+	// get preview
+	var preview string
+	if w.index >= 0 && int(w.index) < len(samples) {
+		preview = samples[w.index]
+	}
 
 	// draw
 	win.Layout(
@@ -46,36 +168,267 @@ func (w *profileWindow) draw(mw *giu.MasterWindow) {
 					w.stream = true
 				}),
 			}),
+			giu.Combo("Sample", preview, samples, &w.index).Size(200).OnChange(func() {
+				w.sample = samples[w.index]
+				w.rebuild()
+			}),
+			giu.Combo("Granularity", profileGranularities[w.gran], profileGranularities, &w.gran).Size(120).OnChange(w.rebuild),
+			giu.Menu(lo.Ternary(w.filter.active(), "Filter (active)", "Filter")).Layout(
+				giu.InputText(&w.filter.focus).Label("Focus").Hint("regexp").Flags(giu.InputTextFlagsEnterReturnsTrue).OnChange(w.rebuild),
+				giu.InputText(&w.filter.ignore).Label("Ignore").Hint("regexp").Flags(giu.InputTextFlagsEnterReturnsTrue).OnChange(w.rebuild),
+				giu.InputText(&w.filter.hide).Label("Hide").Hint("regexp").Flags(giu.InputTextFlagsEnterReturnsTrue).OnChange(w.rebuild),
+				giu.InputText(&w.filter.show).Label("Show").Hint("regexp").Flags(giu.InputTextFlagsEnterReturnsTrue).OnChange(w.rebuild),
+				giu.Checkbox("Prune Runtime", &w.filter.prune).OnChange(w.rebuild),
+				giu.MenuItem("Reset").OnClick(func() {
+					w.filter = profileFilter{}
+					w.rebuild()
+				}),
+			),
+			giu.Menu(lo.Ternary(w.filter.tagged(), "Tags ("+w.filter.tag+"="+w.filter.value+")", "Tags")).Enabled(len(w.tags) > 0).Layout(
+				giu.Menu("Key").Layout(giu.Custom(func() {
+					for _, tag := range w.tags {
+						giu.MenuItem(tag).Selected(tag == w.filter.tag).OnClick(func() {
+							w.filter.tag = tag
+							w.filter.value = ""
+							w.rebuild()
+						}).Build()
+					}
+				})),
+				giu.Menu("Value").Enabled(w.filter.tag != "").Layout(giu.Custom(func() {
+					giu.MenuItem("(all)").Selected(w.filter.value == "").OnClick(func() {
+						w.filter.value = ""
+						w.rebuild()
+					}).Build()
+					for _, total := range w.totals {
+						giu.MenuItem(total.value).Selected(total.value == w.filter.value).OnClick(func() {
+							w.filter.value = total.value
+							w.rebuild()
+						}).Build()
+					}
+				})),
+				giu.Checkbox("Show Pivot", &w.pivot),
+			),
+			giu.Menu("Export").Layout(
+				giu.MenuItem("Profile (.pb.gz)").Enabled(w.raw != nil).OnClick(func() {
+					w.export(".pb.gz", func(path string) error {
+						return exportProfile(path, w.raw)
+					})
+				}),
+				giu.MenuItem("Folded Stacks (.txt)").Enabled(w.profile != nil).OnClick(func() {
+					w.export(".folded.txt", func(path string) error {
+						return exportFolded(path, w.profile)
+					})
+				}),
+				giu.MenuItem("Flame Graph (.svg)").Enabled(w.profile != nil).OnClick(func() {
+					w.export(".svg", func(path string) error {
+						return exportFlameGraph(path, w.title, unit, w.profile)
+					})
+				}),
+			),
+			giu.InputText(&w.search).Hint("Search").Size(200).OnChange(w.find),
+			giu.Condition(w.match != nil && w.profile != nil, giu.Layout{
+				giu.Custom(func() {
+					// get share, an empty or fully diffed profile has no total
+					var share float64
+					if w.profile.total != 0 {
+						share = float64(w.matched) / float64(w.profile.total) * 100
+					}
+					giu.Labelf("%.2f%% (%s)", share, fmtValue(w.matched, unit)).Build()
+				}),
+			}, nil),
+			giu.Condition(w.invalid != nil, giu.Layout{
+				giu.Style().SetColor(giu.StyleColorText, color.RGBA{R: 220, G: 80, B: 80, A: 255}).To(
+					giu.Label(fmt.Sprint(w.invalid)),
+				),
+			}, nil),
+			giu.Condition(w.srcFile != "", giu.Layout{
+				giu.MenuItem("Close Source").OnClick(func() {
+					w.srcFn = ""
+					w.srcFile = ""
+					w.source = nil
+				}),
+			}, nil),
+			giu.Condition(w.raw != nil, giu.Layout{
+				giu.Label(w.describe()),
+			}, nil),
+			giu.Condition(w.status != "", giu.Layout{
+				giu.Label(w.status),
+			}, nil),
 		),
 
-		giu.Custom(func() {
+		giu.Child().Size(0, -w.panelHeight()).Layout(giu.Custom(func() {
 			// check profile
 			if w.profile == nil {
 				return
 			}
 
+			// get position and size
+			pos := giu.GetCursorPos()
+			width, _ := giu.GetAvailableRegion()
+
 			// override style
 			giu.PushStyleColor(giu.StyleColorProgressBarActive, color.RGBA{R: 58, G: 82, B: 99, A: 255})
 			defer giu.PopStyleColor()
 
 			// walk profile
-			walkProfile(w.profile, func(level int, offset, length float32, name string, self, total int64) {
+			walkProfile(w.profile, func(level int, offset, length float32, node *node) {
 				// set cursor
-				giu.SetCursorPos(image.Pt(posX+int(offset*width), posY+level*30))
+				giu.SetCursorPos(image.Pt(pos.X+int(offset*width), pos.Y+level*30))
 
 				// get text
-				var text string
-				switch w.name {
-				case "cpu", "block", "mutex":
-					text = fmt.Sprintf("%s (%s/%s)", name, time.Duration(self).String(), time.Duration(total).String())
-				case "allocs", "heap":
-					text = fmt.Sprintf("%s (%s/%s)", name, fmtBytes(self), fmtBytes(total))
+				text := fmt.Sprintf("%s (%s/%s)", node.name, fmtValue(node.self, unit), fmtValue(node.total, unit))
+
+				// get tooltip, shares are omitted for diffs without a positive total
+				tooltip := text
+				if loc := node.location(); loc != "" {
+					tooltip += "\n" + loc
+				}
+				for i, part := range node.parts {
+					if part != 0 && node.total > 0 {
+						tooltip += fmt.Sprintf("\n%s: %s (%.1f%%)", w.builder.targets[i], fmtValue(part, unit), float64(part)/float64(node.total)*100)
+					} else if part != 0 {
+						tooltip += fmt.Sprintf("\n%s: %s", w.builder.targets[i], fmtValue(part, unit))
+					}
+				}
+
+				// highlight matches and dim the rest
+				if w.match != nil {
+					if w.match.MatchString(node.name) {
+						giu.PushStyleColor(giu.StyleColorPlotHistogram, color.RGBA{R: 230, G: 140, B: 40, A: 255})
+						giu.PushStyleColor(giu.StyleColorFrameBg, color.RGBA{R: 150, G: 90, B: 30, A: 255})
+						giu.PushStyleColor(giu.StyleColorText, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+					} else {
+						giu.PushStyleColor(giu.StyleColorPlotHistogram, color.RGBA{R: 60, G: 60, B: 60, A: 255})
+						giu.PushStyleColor(giu.StyleColorFrameBg, color.RGBA{R: 45, G: 45, B: 45, A: 255})
+						giu.PushStyleColor(giu.StyleColorText, color.RGBA{R: 120, G: 120, B: 120, A: 255})
+					}
 				}
 
 				// build tooltip and button
-				giu.ProgressBar(float32(self)/float32(total)).Size(length*width, 30).Overlay(text).Build()
-				giu.Tooltip(text).Build()
+				giu.ProgressBar(float32(node.self)/float32(node.total)).Size(length*width, 30).Overlay(text).Build()
+				if w.match != nil {
+					giu.PopStyleColorV(3)
+				}
+				giu.Tooltip(tooltip).Build()
+
+				// select source on click
+				if node.file != "" && giu.IsItemClicked(giu.MouseButtonLeft) {
+					w.srcFn = node.fn
+					w.srcFile = node.file
+					w.annotate()
+				}
 			})
-		}),
+		})),
+
+		giu.Condition(w.srcFile != "", giu.Layout{
+			giu.Label(w.srcFile),
+			giu.Custom(func() {
+				// check source
+				if w.source == nil {
+					giu.Label("Source not found, set -source-root to a local source tree.").Build()
+					return
+				}
+
+				// prepare rows
+				rows := make([]*giu.TableRowWidget, 0, len(w.source))
+				for _, line := range w.source {
+					row := giu.TableRow(
+						giu.Label(lo.Ternary(line.flat != 0, fmtValue(line.flat, unit), "")),
+						giu.Label(lo.Ternary(line.cum != 0, fmtValue(line.cum, unit), "")),
+						giu.Label(strconv.FormatInt(line.number, 10)),
+						giu.Label(line.text),
+					)
+					if line.cum != 0 {
+						row.BgColor(color.RGBA{R: 58, G: 82, B: 99, A: 255})
+					}
+					rows = append(rows, row)
+				}
+
+				// draw table
+				giu.Table().Flags(giu.TableFlagsScrollY|giu.TableFlagsRowBg).Columns(
+					giu.TableColumn("Flat").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(100),
+					giu.TableColumn("Cum").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(100),
+					giu.TableColumn("Line").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(50),
+					giu.TableColumn("Source").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+				).Rows(rows...).Build()
+			}),
+		}, nil),
+
+		giu.Condition(w.pivot && w.filter.tag != "", giu.Layout{
+			giu.Label("Breakdown by " + w.filter.tag),
+			giu.Custom(func() {
+				// get total
+				var sum int64
+				for _, total := range w.totals {
+					sum += total.total
+				}
+
+				// prepare rows
+				rows := make([]*giu.TableRowWidget, 0, len(w.totals))
+				for _, total := range w.totals {
+					row := giu.TableRow(
+						giu.Label(total.value),
+						giu.Label(fmtValue(total.total, unit)),
+						giu.Label(fmt.Sprintf("%.2f%%", float64(total.total)/float64(max(sum, 1))*100)),
+					)
+					if total.value == w.filter.value {
+						row.BgColor(color.RGBA{R: 58, G: 82, B: 99, A: 255})
+					}
+					rows = append(rows, row)
+				}
+
+				// draw table
+				giu.Table().Size(0, 250).Flags(giu.TableFlagsScrollY|giu.TableFlagsRowBg).Columns(
+					giu.TableColumn("Value").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+					giu.TableColumn("Total").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(100),
+					giu.TableColumn("Percent").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(80),
+				).Rows(rows...).Build()
+			}),
+		}, nil),
 	)
 }
+
+func (w *profileWindow) panelHeight() float32 {
+	// sum panel heights
+	var height float32
+	if w.srcFile != "" {
+		height += 300
+	}
+	if w.pivot && w.filter.tag != "" {
+		height += 280
+	}
+
+	return height
+}
+
+func (w *profileWindow) export(ext string, fn func(path string) error) {
+	// get path
+	path := exportPath(w.name, ext)
+
+	// export
+	err := fn(path)
+	if err != nil {
+		w.status = "Export failed: " + err.Error()
+		return
+	}
+
+	// set status
+	w.status = "Saved " + path
+}
+
+func (w *profileWindow) describe() string {
+	// get duration
+	duration := time.Duration(w.raw.DurationNanos).Round(time.Millisecond)
+
+	// describe mode
+	switch w.mode {
+	case sampledProfile:
+		return fmt.Sprintf("Sampled by target over %s", duration)
+	case deltaProfile:
+		return fmt.Sprintf("Delta computed over %s", duration)
+	case fileProfile:
+		return "Opened from file"
+	default:
+		return "Snapshot at " + time.Unix(0, w.raw.TimeNanos).Format("15:04:05")
+	}
+}
@@ -0,0 +1,152 @@
+package trace
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Span is a running operation that is emitted when it ends.
+type Span struct {
+	hub     *Hub
+	name    string
+	task    string
+	label   string
+	id      string
+	parent  string
+	start   time.Time
+	stop    time.Time
+	attrs   map[string]string
+	failed  bool
+	message string
+	marks   []mark
+	ended   bool
+	mutex   sync.Mutex
+}
+
+type mark struct {
+	Name  string            `json:"name"`
+	Time  time.Time         `json:"time"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+type record struct {
+	Version int               `json:"v"`
+	Stream  string            `json:"stream"`
+	Task    string            `json:"task"`
+	Span    string            `json:"span,omitempty"`
+	ID      string            `json:"id,omitempty"`
+	Parent  string            `json:"parent,omitempty"`
+	Start   time.Time         `json:"start"`
+	Stop    time.Time         `json:"stop"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Events  []mark            `json:"events,omitempty"`
+}
+
+// Child starts and returns a nested span with the provided label. The child
+// is shown below its parent in the task of the parent.
+func (s *Span) Child(label string) *Span {
+	return &Span{
+		hub:    s.hub,
+		name:   s.name,
+		task:   s.task,
+		label:  label,
+		id:     newID(),
+		parent: s.id,
+		start:  time.Now(),
+	}
+}
+
+// Attr sets an attribute.
+func (s *Span) Attr(key, value string) *Span {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// set attribute
+	if s.attrs == nil {
+		s.attrs = map[string]string{}
+	}
+	s.attrs[key] = value
+
+	return s
+}
+
+// Event records a named event at the current time.
+func (s *Span) Event(name string) *Span {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// add mark
+	s.marks = append(s.marks, mark{
+		Name: name,
+		Time: time.Now(),
+	})
+
+	return s
+}
+
+// Fail marks the span as failed if the error is not nil.
+func (s *Span) Fail(err error) *Span {
+	// check error
+	if err == nil {
+		return s
+	}
+
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// set status
+	s.failed = true
+	s.message = err.Error()
+
+	return s
+}
+
+// End ends the span and emits it. Additional calls are ignored.
+func (s *Span) End() {
+	// acquire mutex
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.stop = time.Now()
+	s.mutex.Unlock()
+
+	// emit span
+	s.hub.emit(s)
+}
+
+func (s *Span) record() record {
+	// acquire mutex
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// prepare record, attributes and events are copied as they may still be
+	// changed after the span ended
+	r := record{
+		Version: Version,
+		Stream:  s.name,
+		Task:    s.task,
+		Span:    s.label,
+		ID:      s.id,
+		Parent:  s.parent,
+		Start:   s.start,
+		Stop:    s.stop,
+		Attrs:   maps.Clone(s.attrs),
+		Message: s.message,
+		Events:  slices.Clone(s.marks),
+	}
+	if s.failed {
+		r.Status = "error"
+	}
+
+	return r
+}
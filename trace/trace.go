@@ -0,0 +1,168 @@
+// Package trace emits trace events to gov.
+//
+// Mount the handler on the path gov streams traces from and record spans:
+//
+//	http.Handle("/trace", trace.Handler())
+//
+//	span := trace.Start("api", "GET /users")
+//	defer span.End()
+//
+// Events are only encoded while a gov instance is connected. Each connection
+// has a bounded buffer and events are dropped if it is full.
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Version is the version of the emitted trace format.
+const Version = 1
+
+// DefaultBuffer is the number of events buffered per connection.
+const DefaultBuffer = 1024
+
+// DefaultHub is the hub used by Start and Handler.
+var DefaultHub = NewHub(DefaultBuffer)
+
+// Handler returns the handler of the default hub.
+func Handler() http.Handler {
+	return DefaultHub
+}
+
+// Start starts a span using the default hub.
+func Start(name, task string) *Span {
+	return DefaultHub.Start(name, task)
+}
+
+// Hub distributes events to connected viewers.
+type Hub struct {
+	buffer  int
+	viewers map[chan []byte]struct{}
+	active  atomic.Int64
+	dropped atomic.Int64
+	mutex   sync.Mutex
+}
+
+// NewHub creates and returns a new hub with the provided per connection buffer.
+func NewHub(buffer int) *Hub {
+	return &Hub{
+		buffer:  buffer,
+		viewers: map[chan []byte]struct{}{},
+	}
+}
+
+// Start starts and returns a new span with the provided stream name and task.
+func (h *Hub) Start(name, task string) *Span {
+	return &Span{
+		hub:   h,
+		name:  name,
+		task:  task,
+		id:    newID(),
+		start: time.Now(),
+	}
+}
+
+// Dropped returns the number of events dropped because a buffer was full.
+func (h *Hub) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+// ServeHTTP implements the http.Handler interface. Events are streamed as
+// Server-Sent Events if requested and as JSON lines otherwise.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check flusher
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// register viewer
+	viewer := make(chan []byte, h.buffer)
+	h.mutex.Lock()
+	h.viewers[viewer] = struct{}{}
+	h.active.Add(1)
+	h.mutex.Unlock()
+
+	// ensure unregister
+	defer func() {
+		h.mutex.Lock()
+		delete(h.viewers, viewer)
+		h.active.Add(-1)
+		h.mutex.Unlock()
+	}()
+
+	// write header
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// prepare writer, lines are shared by all viewers and must not be modified
+	write := func(line []byte) error {
+		if sse {
+			_, err := w.Write([]byte("data: " + string(line) + "\n\n"))
+			return err
+		}
+		_, err := w.Write([]byte(string(line) + "\n"))
+		return err
+	}
+
+	// write events
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-viewer:
+			// write event and buffered events before flushing
+			err := write(line)
+			for len(viewer) > 0 && err == nil {
+				err = write(<-viewer)
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Hub) emit(s *Span) {
+	// skip if no viewer is connected
+	if h.active.Load() == 0 {
+		return
+	}
+
+	// encode event
+	line, err := json.Marshal(s.record())
+	if err != nil {
+		return
+	}
+
+	// send event without blocking
+	h.mutex.Lock()
+	for viewer := range h.viewers {
+		select {
+		case viewer <- line:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+	h.mutex.Unlock()
+}
+
+func newID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
@@ -0,0 +1,199 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func connect(t *testing.T, hub *Hub, accept string) (*bufio.Reader, *http.Response) {
+	// start server
+	server := httptest.NewServer(hub)
+	t.Cleanup(server.Close)
+
+	// open stream, the viewer is registered once the headers are received
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", accept)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = res.Body.Close()
+	})
+
+	return bufio.NewReader(res.Body), res
+}
+
+func readRecord(t *testing.T, reader *bufio.Reader, prefix string) record {
+	// read line
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check prefix
+	if !strings.HasPrefix(line, prefix) {
+		t.Fatalf("missing prefix %q: %q", prefix, line)
+	}
+
+	// decode record
+	var r record
+	err = json.Unmarshal([]byte(strings.TrimPrefix(line, prefix)), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestSpanNesting(t *testing.T) {
+	hub := NewHub(DefaultBuffer)
+	reader, res := connect(t, hub, "")
+	if ct := res.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("got content type %q", ct)
+	}
+
+	// record nested spans
+	root := hub.Start("api", "GET /users")
+	child := root.Child("db.query").Attr("table", "users").Event("retry")
+	grandchild := child.Child("db.connect").Fail(errors.New("timeout"))
+	grandchild.End()
+	child.End()
+	root.End()
+
+	// check records in emit order
+	r := readRecord(t, reader, "")
+	if r.Version != Version || r.Stream != "api" || r.Task != "GET /users" || r.Span != "db.connect" || r.Status != "error" || r.Message != "timeout" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	grandchildID, grandchildParent := r.ID, r.Parent
+	r = readRecord(t, reader, "")
+	if r.Span != "db.query" || r.Attrs["table"] != "users" || len(r.Events) != 1 || r.Events[0].Name != "retry" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	childID, childParent := r.ID, r.Parent
+	r = readRecord(t, reader, "")
+	if r.Span != "" || r.Parent != "" || r.Stop.Before(r.Start) {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+
+	// check links
+	if grandchildParent != childID || childParent != r.ID || grandchildID == childID {
+		t.Fatalf("unexpected links: %s -> %s -> %s", grandchildParent, childParent, r.ID)
+	}
+}
+
+func TestHubSSE(t *testing.T) {
+	hub := NewHub(DefaultBuffer)
+	reader, res := connect(t, hub, "text/event-stream")
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got content type %q", ct)
+	}
+
+	// emit spans
+	hub.Start("api", "a").End()
+	hub.Start("api", "b").End()
+
+	// check events
+	for _, task := range []string{"a", "b"} {
+		r := readRecord(t, reader, "data: ")
+		if r.Task != task {
+			t.Fatalf("got task %q, want %q", r.Task, task)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil || line != "\n" {
+			t.Fatalf("missing event terminator: %q, %v", line, err)
+		}
+	}
+}
+
+func TestHubDropOnFull(t *testing.T) {
+	hub := NewHub(2)
+
+	// emit without viewers
+	hub.Start("api", "a").End()
+	if hub.Dropped() != 0 {
+		t.Fatalf("got %d dropped events", hub.Dropped())
+	}
+
+	// register a viewer that does not read
+	viewer := make(chan []byte, hub.buffer)
+	hub.mutex.Lock()
+	hub.viewers[viewer] = struct{}{}
+	hub.active.Add(1)
+	hub.mutex.Unlock()
+
+	// emit more events than buffered without blocking
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			hub.Start("api", "a").End()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("emit blocked")
+	}
+
+	// check counts
+	if len(viewer) != 2 || hub.Dropped() != 3 {
+		t.Fatalf("got %d buffered and %d dropped events", len(viewer), hub.Dropped())
+	}
+}
+
+func TestSpanEndTwice(t *testing.T) {
+	hub := NewHub(DefaultBuffer)
+	reader, _ := connect(t, hub, "")
+
+	// end twice
+	span := hub.Start("api", "a")
+	span.End()
+	span.End()
+	hub.Start("api", "b").End()
+
+	// check that only one event was emitted for the span
+	if r := readRecord(t, reader, ""); r.Task != "a" {
+		t.Fatalf("got task %q", r.Task)
+	}
+	if r := readRecord(t, reader, ""); r.Task != "b" {
+		t.Fatalf("got task %q", r.Task)
+	}
+}
+
+func TestSpanConcurrentUse(t *testing.T) {
+	hub := NewHub(DefaultBuffer)
+	reader, _ := connect(t, hub, "")
+	_, _ = connect(t, hub, "")
+
+	// modify the span while it ends
+	span := hub.Start("api", "a")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				span.Attr("key", "value").Event("event")
+			}
+		}()
+	}
+	span.End()
+	wg.Wait()
+
+	// check event
+	if r := readRecord(t, reader, ""); r.Task != "a" {
+		t.Fatalf("got task %q", r.Task)
+	}
+}
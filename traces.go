@@ -1,66 +1,223 @@
 package main
 
 import (
-	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/samber/lo"
 )
 
-const traceLength = 10 * time.Second
-
 var traceStreams = map[string]*traceStream{}
+var traceCount int
+var tracePruned time.Time
+var traceStatus string
+var traceInvalid int
+var traceInvalidReported time.Time
+var traceRetry = make(chan struct{}, 1)
 var traceMutex sync.Mutex
 
-func loadTraces(url string, refresh func()) error {
+var errTraceNotFound = errors.New("trace endpoint not found")
+
+const traceStableTime = 10 * time.Second
+
+func loadTraces(url string, refresh func()) (bool, error) {
+	// prepare handler
+	handle := func(line string) {
+		// skip empty lines used as keep alive
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+
+		// parse line
+		name, task, event, err := parseTraceLine(line)
+		if err != nil {
+			reportInvalidTrace(err)
+			return
+		}
+
+		// add event
+		addTraceEvent(name, task, event)
+
+		// refresh
+		refresh()
+	}
+
+	// use websocket for websocket urls
+	if strings.HasPrefix(url, "ws://") || strings.HasPrefix(url, "wss://") {
+		return streamTraceSocket(url, handle)
+	}
+
+	// prepare request
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream, application/x-ndjson, text/plain")
+
 	// open stream
-	res, err := http.Get(url)
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer res.Body.Close()
 
-	// scan stream
-	scanner := bufio.NewScanner(res.Body)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		// split line
-		seg := strings.Split(scanner.Text(), ";")
-		if len(seg) != 4 {
-			continue
+	// check status
+	if res.StatusCode == http.StatusNotFound {
+		return false, errTraceNotFound
+	} else if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	// scan events or lines
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if contentType == "text/event-stream" {
+		setTraceStatus("Connected (SSE)")
+		return true, scanTraceEvents(res.Body, handle)
+	}
+	setTraceStatus("Connected")
+
+	return true, scanTraceLines(res.Body, handle)
+}
+
+func setTraceStatus(status string) {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	// set status
+	traceStatus = status
+}
+
+func getTraceStatus() string {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	return traceStatus
+}
+
+func reportInvalidTrace(err error) {
+	// count line
+	traceMutex.Lock()
+	traceInvalid++
+	count := traceInvalid
+	now := time.Now()
+	report := now.Sub(traceInvalidReported) >= time.Second
+	if report {
+		traceInvalidReported = now
+	}
+	traceMutex.Unlock()
+
+	// report at most once per second
+	if report {
+		println(fmt.Sprintf("trace: invalid line (%d total): %s", count, err))
+	}
+}
+
+func getTraceInvalid() int {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	return traceInvalid
+}
+
+func retryTraces() {
+	// signal retry if not pending
+	select {
+	case traceRetry <- struct{}{}:
+	default:
+	}
+}
+
+func addTraceEvent(name, task string, event traceEvent) {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	// get stream
+	stream := traceStreams[name]
+	if stream == nil {
+		stream = &traceStream{
+			tasks: map[string]*traceRing{},
 		}
+		traceStreams[name] = stream
+	}
 
-		// get fields
-		name := seg[0]
-		task := seg[1]
-		start, _ := time.Parse(time.RFC3339Nano, seg[2])
-		stop, _ := time.Parse(time.RFC3339Nano, seg[3])
+	// get ring
+	ring := stream.tasks[task]
+	if ring == nil {
+		ring = &traceRing{}
+		stream.tasks[task] = ring
+	}
 
-		// add event
-		traceMutex.Lock()
-		stream := traceStreams[name]
-		if stream == nil {
-			stream = &traceStream{
-				events: map[string][]traceEvent{},
+	// add event
+	ring.push(event)
+	traceCount++
+	recordTraceDuration(name, task, event)
+
+	// prune ring
+	now := time.Now()
+	cutoff := now.Add(-*traceLength)
+	traceCount -= ring.prune(cutoff)
+
+	// prune idle rings regularly
+	if now.Sub(tracePruned) >= time.Second {
+		tracePruned = now
+		sweepTraces(cutoff)
+	}
+
+	// evict oldest events down to 90% of the limit
+	if traceCount > *traceLimit {
+		evictTraces(*traceLimit * 9 / 10)
+	}
+}
+
+func evictTraces(limit int) {
+	// collect non-empty rings
+	var rings traceRingHeap
+	for _, stream := range traceStreams {
+		for _, ring := range stream.tasks {
+			if ring.size > 0 {
+				rings = append(rings, ring)
 			}
-			traceStreams[name] = stream
 		}
-		stream.events[task] = append(stream.events[task], traceEvent{
-			start: start,
-			stop:  stop,
-		})
-		max := time.Now().Add(-traceLength)
-		stream.events[task] = lo.Filter(stream.events[task], func(event traceEvent, i int) bool {
-			return event.stop.After(max)
-		})
-		traceMutex.Unlock()
+	}
 
-		// refresh
-		refresh()
+	// order rings by their oldest event
+	heap.Init(&rings)
+
+	// remove oldest events across all rings
+	for traceCount > limit && len(rings) > 0 {
+		ring := rings[0]
+		ring.pop()
+		traceCount--
+		if ring.size == 0 {
+			heap.Pop(&rings)
+		} else {
+			heap.Fix(&rings, 0)
+		}
 	}
 
-	return scanner.Err()
+	// remove emptied rings and streams
+	sweepTraces(time.Time{})
+}
+
+func sweepTraces(cutoff time.Time) {
+	// prune rings and remove empty rings and streams, mutex is held by caller
+	for name, stream := range traceStreams {
+		for task, ring := range stream.tasks {
+			traceCount -= ring.prune(cutoff)
+			if ring.size == 0 {
+				delete(stream.tasks, task)
+			}
+		}
+		if len(stream.tasks) == 0 {
+			delete(traceStreams, name)
+		}
+	}
 }
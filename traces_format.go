@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const traceVersion = 1
+
+type traceRecord struct {
+	Version int               `json:"v"`
+	Stream  string            `json:"stream"`
+	Task    string            `json:"task"`
+	Span    string            `json:"span,omitempty"`
+	ID      string            `json:"id,omitempty"`
+	Parent  string            `json:"parent,omitempty"`
+	Start   time.Time         `json:"start"`
+	Stop    time.Time         `json:"stop"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Events  []traceMarkRecord `json:"events,omitempty"`
+}
+
+type traceMarkRecord struct {
+	Name  string            `json:"name"`
+	Time  time.Time         `json:"time"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+func parseTraceLine(line string) (string, string, traceEvent, error) {
+	// check line
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", "", traceEvent{}, errors.New("empty line")
+	}
+
+	// parse structured or legacy line
+	if strings.HasPrefix(line, "{") {
+		return parseTraceRecord(line)
+	}
+
+	return parseTraceLegacy(line)
+}
+
+func parseTraceLegacy(line string) (string, string, traceEvent, error) {
+	// split line
+	seg := strings.Split(line, ";")
+	if len(seg) != 4 {
+		return "", "", traceEvent{}, fmt.Errorf("expected 4 fields, got %d", len(seg))
+	}
+
+	// parse times
+	start, err := time.Parse(time.RFC3339Nano, seg[2])
+	if err != nil {
+		return "", "", traceEvent{}, err
+	}
+	stop, err := time.Parse(time.RFC3339Nano, seg[3])
+	if err != nil {
+		return "", "", traceEvent{}, err
+	}
+
+	// prepare event
+	event := traceEvent{
+		start: start,
+		stop:  stop,
+	}
+
+	return seg[0], seg[1], event, validateTrace(seg[0], seg[1], event)
+}
+
+func parseTraceRecord(line string) (string, string, traceEvent, error) {
+	// decode record
+	var record traceRecord
+	err := json.Unmarshal([]byte(line), &record)
+	if err != nil {
+		return "", "", traceEvent{}, err
+	}
+
+	// check version
+	if record.Version != traceVersion {
+		return "", "", traceEvent{}, fmt.Errorf("unsupported version: %d", record.Version)
+	}
+
+	// check status
+	if record.Status != "" && record.Status != "ok" && record.Status != "error" {
+		return "", "", traceEvent{}, fmt.Errorf("invalid status: %q", record.Status)
+	}
+
+	// prepare event
+	event := traceEvent{
+		start:   record.Start,
+		stop:    record.Stop,
+		id:      record.ID,
+		parent:  record.Parent,
+		label:   record.Span,
+		attrs:   record.Attrs,
+		failed:  record.Status == "error",
+		message: record.Message,
+	}
+	for _, mark := range record.Events {
+		event.marks = append(event.marks, traceMark{
+			name:  mark.Name,
+			time:  mark.Time,
+			attrs: mark.Attrs,
+		})
+	}
+
+	return record.Stream, record.Task, event, validateTrace(record.Stream, record.Task, event)
+}
+
+func validateTrace(name, task string, event traceEvent) error {
+	// check names
+	if name == "" {
+		return errors.New("missing stream")
+	} else if task == "" {
+		return errors.New("missing task")
+	}
+
+	// check times
+	if event.start.IsZero() || event.stop.IsZero() {
+		return errors.New("missing start or stop")
+	} else if event.stop.Before(event.start) {
+		return errors.New("stop before start")
+	}
+
+	return nil
+}
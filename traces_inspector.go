@@ -0,0 +1,202 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AllenDang/giu"
+	"github.com/samber/lo"
+)
+
+const traceSlowestSpans = 20
+
+type traceSpan struct {
+	task  string
+	event traceEvent
+}
+
+func (s *traceSpan) same(o *traceSpan) bool {
+	return o != nil && s.task == o.task && s.event.id == o.event.id &&
+		s.event.start.Equal(o.event.start) && s.event.stop.Equal(o.event.stop)
+}
+
+func (s *traceSpan) duration() time.Duration {
+	return s.event.stop.Sub(s.event.start)
+}
+
+func (s *traceSpan) title() string {
+	// get name
+	name := s.task
+	if s.event.label != "" {
+		name += " / " + s.event.label
+	}
+
+	return fmt.Sprintf("%s (%s)", name, s.duration())
+}
+
+func (s *traceSpan) describe() string {
+	// add basics
+	lines := []string{
+		"Task: " + s.task,
+	}
+	if s.event.label != "" {
+		lines = append(lines, "Span: "+s.event.label)
+	}
+	lines = append(lines,
+		"Start: "+s.event.start.Format("15:04:05.000000"),
+		"Stop: "+s.event.stop.Format("15:04:05.000000"),
+		"Duration: "+s.duration().String(),
+	)
+
+	// add status
+	if s.event.failed {
+		lines = append(lines, "Status: error "+s.event.message)
+	} else if s.event.message != "" {
+		lines = append(lines, "Message: "+s.event.message)
+	}
+
+	// add attributes
+	keys := lo.Keys(s.event.attrs)
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, key+": "+s.event.attrs[key])
+	}
+
+	// add marks
+	for _, mark := range s.event.marks {
+		lines = append(lines, fmt.Sprintf("@+%s %s", mark.time.Sub(s.event.start), mark.name))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func traceNeighbours(events map[string][]traceEvent, span *traceSpan) (parent *traceSpan, children []*traceSpan, prev, next *traceSpan) {
+	for task, list := range events {
+		for _, event := range list {
+			// check parent and children, spans received over OTLP are grouped
+			// into tasks by name and may be linked across tasks
+			if span.event.parent != "" && event.id == span.event.parent {
+				parent = &traceSpan{task: task, event: event}
+			}
+			if span.event.id != "" && event.parent == span.event.id {
+				children = append(children, &traceSpan{task: task, event: event})
+			}
+
+			// check siblings on the same level, root spans only within the task
+			if event.parent != span.event.parent || span.event.parent == "" && task != span.task {
+				continue
+			}
+			if event.start.Before(span.event.start) && (prev == nil || event.start.After(prev.event.start)) {
+				prev = &traceSpan{task: task, event: event}
+			}
+			if event.start.After(span.event.start) && (next == nil || event.start.Before(next.event.start)) {
+				next = &traceSpan{task: task, event: event}
+			}
+		}
+	}
+
+	// sort children
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].event.start.Before(children[j].event.start)
+	})
+
+	return parent, children, prev, next
+}
+
+type traceSpanHeap []*traceSpan
+
+func (h traceSpanHeap) Len() int {
+	return len(h)
+}
+
+func (h traceSpanHeap) Less(i, j int) bool {
+	return h[i].duration() < h[j].duration()
+}
+
+func (h traceSpanHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *traceSpanHeap) Push(x any) {
+	*h = append(*h, x.(*traceSpan))
+}
+
+func (h *traceSpanHeap) Pop() any {
+	old := *h
+	span := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return span
+}
+
+func traceSlowest(events map[string][]traceEvent, start, end time.Time, limit int) []*traceSpan {
+	// keep the slowest visible spans in a bounded min heap
+	spans := make(traceSpanHeap, 0, limit)
+	for task, list := range events {
+		for _, event := range list {
+			// check visibility
+			if !event.stop.After(start) || !event.start.Before(end) {
+				continue
+			}
+
+			// add span or replace the fastest
+			if len(spans) < limit {
+				heap.Push(&spans, &traceSpan{task: task, event: event})
+			} else if limit > 0 && event.stop.Sub(event.start) > spans[0].duration() {
+				spans[0] = &traceSpan{task: task, event: event}
+				heap.Fix(&spans, 0)
+			}
+		}
+	}
+
+	// sort by duration
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].duration() > spans[j].duration()
+	})
+
+	return spans
+}
+
+func (w *traceWindow) buildInspector(events map[string][]traceEvent, start time.Time, span time.Duration) giu.Widget {
+	// prepare widgets
+	var widgets giu.Layout
+
+	// add span list
+	addSpans := func(title string, spans ...*traceSpan) {
+		if len(spans) == 0 {
+			return
+		}
+		widgets = append(widgets, giu.Separator(), giu.Label(title))
+		for i, s := range spans {
+			widgets = append(widgets, giu.Selectable(s.title()+"##"+title+strconv.Itoa(i)).Selected(s.same(w.selected)).OnClick(func() {
+				w.selected = s
+			}))
+		}
+	}
+
+	// add selection
+	if w.selected != nil {
+		parent, children, prev, next := traceNeighbours(events, w.selected)
+		widgets = append(widgets, giu.Label(w.selected.describe()))
+		if parent != nil {
+			addSpans("Parent", parent)
+		}
+		addSpans("Children", children...)
+		if prev != nil {
+			addSpans("Previous", prev)
+		}
+		if next != nil {
+			addSpans("Next", next)
+		}
+	} else {
+		widgets = append(widgets, giu.Label("Click a span to inspect it."))
+	}
+
+	// add slowest spans
+	addSpans("Slowest Visible", traceSlowest(events, start, start.Add(span), traceSlowestSpans)...)
+
+	return widgets
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraceNeighbours(t *testing.T) {
+	// prepare spans grouped by name like OTLP spans
+	now := time.Now()
+	at := func(ms int) time.Time {
+		return now.Add(time.Duration(ms) * time.Millisecond)
+	}
+	events := map[string][]traceEvent{
+		"GET /users": {
+			{id: "a", start: at(0), stop: at(10)},
+			{id: "e", start: at(20), stop: at(30)},
+		},
+		"db.query": {
+			{id: "b", parent: "a", start: at(1), stop: at(3)},
+			{id: "c", parent: "a", start: at(4), stop: at(6)},
+		},
+		"db.connect": {
+			{id: "d", parent: "b", start: at(1), stop: at(2)},
+		},
+		"other": {
+			{id: "f", start: at(5), stop: at(8)},
+		},
+	}
+
+	// check root span
+	root := &traceSpan{task: "GET /users", event: events["GET /users"][0]}
+	parent, children, prev, next := traceNeighbours(events, root)
+	if parent != nil || len(children) != 2 || children[0].event.id != "b" || children[1].event.id != "c" {
+		t.Fatalf("got %v, %v", parent, children)
+	}
+	if prev != nil || next == nil || next.event.id != "e" {
+		t.Fatalf("got %v, %v", prev, next)
+	}
+
+	// check child span across tasks
+	child := &traceSpan{task: "db.query", event: events["db.query"][0]}
+	parent, children, prev, next = traceNeighbours(events, child)
+	if parent == nil || parent.event.id != "a" || parent.task != "GET /users" {
+		t.Fatalf("got %v", parent)
+	}
+	if len(children) != 1 || children[0].event.id != "d" || children[0].task != "db.connect" {
+		t.Fatalf("got %v", children)
+	}
+	if prev != nil || next == nil || next.event.id != "c" {
+		t.Fatalf("got %v, %v", prev, next)
+	}
+}
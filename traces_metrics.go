@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+var traceBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+var traceMetricNames = []string{"rate", "concurrency", "duration", "histogram"}
+
+var traceDurations = map[traceMetricKey][]time.Duration{}
+var traceActivity = map[traceMetricKey]time.Time{}
+
+type traceMetricKey struct {
+	stream string
+	task   string
+	span   string
+}
+
+func (k traceMetricKey) path() []string {
+	// get path
+	path := []string{"trace", k.stream, k.task}
+	if k.span != "" {
+		path = append(path, k.span)
+	}
+
+	return path
+}
+
+func recordTraceDuration(name, task string, event traceEvent) {
+	// add duration, mutex is held by caller
+	key := traceMetricKey{stream: name, task: task, span: event.label}
+	traceDurations[key] = append(traceDurations[key], event.stop.Sub(event.start))
+}
+
+func deriveTraceMetrics(start, end time.Time) {
+	// acquire mutex
+	traceMutex.Lock()
+
+	// swap durations
+	durations := traceDurations
+	traceDurations = make(map[traceMetricKey][]time.Duration, len(durations))
+
+	// sum the time retained calls spent in the interval
+	busy := map[traceMetricKey]time.Duration{}
+	var events []traceEvent
+	for name, stream := range traceStreams {
+		for task, ring := range stream.tasks {
+			events = ring.collect(start, end, events[:0])
+			for _, event := range events {
+				from, to := event.start, event.stop
+				if from.Before(start) {
+					from = start
+				}
+				if to.After(end) {
+					to = end
+				}
+				if overlap := to.Sub(from); overlap > 0 {
+					busy[traceMetricKey{stream: name, task: task, span: event.label}] += overlap
+				}
+			}
+		}
+	}
+
+	// keep keys until they have been idle for the retention window
+	var expired []traceMetricKey
+	for key, list := range durations {
+		if len(list) > 0 || busy[key] > 0 {
+			traceActivity[key] = end
+		}
+		if end.Sub(traceActivity[key]) < *traceLength {
+			traceDurations[key] = nil
+		} else {
+			delete(traceActivity, key)
+			delete(durations, key)
+			expired = append(expired, key)
+		}
+	}
+
+	// release mutex
+	traceMutex.Unlock()
+
+	// acquire mutex
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	// add metrics
+	for key, list := range durations {
+		addTraceMetrics(key, list, busy[key], end.Sub(start))
+	}
+
+	// remove metrics of expired keys
+	for _, key := range expired {
+		for _, name := range traceMetricNames {
+			metricsTree.remove(append(key.path(), name))
+		}
+	}
+}
+
+func addTraceMetrics(key traceMetricKey, durations []time.Duration, busy, interval time.Duration) {
+	// get path and name
+	path := key.path()
+	name := path[1]
+	for _, segment := range path[2:] {
+		name += ":" + segment
+	}
+
+	// sort durations
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+
+	// sum durations
+	var sum time.Duration
+	for _, duration := range durations {
+		sum += duration
+	}
+
+	// add rate and concurrency
+	ensureList(append(path, "rate"), name+":rate", "Completed calls per second.", "default").add(float64(len(durations)) / interval.Seconds())
+	ensureList(append(path, "concurrency"), name+":concurrency", "Average number of calls in flight.", "default").add(busy.Seconds() / interval.Seconds())
+
+	// add duration quantiles
+	quantile := func(q float64) float64 {
+		if len(durations) == 0 {
+			return 0
+		}
+		return durations[int(float64(len(durations)-1)*q)].Seconds()
+	}
+	help := "Call duration in seconds."
+	ensureList(append(path, "duration"), name+":duration", help, "mean").add(sum.Seconds() / float64(max(len(durations), 1)))
+	ensureList(append(path, "duration"), name+":duration", help, "p50").add(quantile(0.5))
+	ensureList(append(path, "duration"), name+":duration", help, "p90").add(quantile(0.9))
+	ensureList(append(path, "duration"), name+":duration", help, "p99").add(quantile(0.99))
+	ensureList(append(path, "duration"), name+":duration", help, "max").add(quantile(1))
+
+	// add histogram buckets
+	help = "Calls per duration bucket in seconds."
+	rest := durations
+	for _, bound := range traceBuckets {
+		count := sort.Search(len(rest), func(i int) bool {
+			return rest[i].Seconds() > bound
+		})
+		rest = rest[count:]
+		ensureList(append(path, "histogram"), name+":histogram", help, "le:"+f2s(bound)).add(float64(count))
+	}
+	ensureList(append(path, "histogram"), name+":histogram", help, "le:+Inf").add(float64(len(rest)))
+}
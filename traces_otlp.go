@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AllenDang/giu"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const otlpUnknownService = "unknown_service"
+
+const otlpMaxBody = 16 << 20
+
+type otlpSpan struct {
+	service string
+	name    string
+	event   traceEvent
+}
+
+func receiveOTLP(w http.ResponseWriter, r *http.Request) {
+	// check method
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// get content type
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	// prepare body
+	var body io.Reader = http.MaxBytesReader(w, r.Body, otlpMaxBody)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// read body, the decompressed size is limited as well
+	data, err := io.ReadAll(io.LimitReader(body, otlpMaxBody+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if len(data) > otlpMaxBody {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// decode spans
+	var spans []otlpSpan
+	switch contentType {
+	case "application/x-protobuf":
+		spans, err = decodeOTLPProto(data)
+	case "application/json":
+		spans, err = decodeOTLPJSON(data)
+	default:
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// add events
+	for _, span := range spans {
+		err = validateTrace(span.service, span.name, span.event)
+		if err != nil {
+			continue
+		}
+		addTraceEvent(span.service, span.name, span.event)
+	}
+
+	// update
+	giu.Update()
+
+	// write empty response
+	w.Header().Set("Content-Type", contentType)
+	if contentType == "application/json" {
+		_, _ = w.Write([]byte("{}"))
+	}
+}
+
+func decodeOTLPProto(data []byte) ([]otlpSpan, error) {
+	// decode resource spans
+	var spans []otlpSpan
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			return decodeOTLPResourceSpans(value, &spans)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spans, nil
+}
+
+func decodeOTLPResourceSpans(data []byte, spans *[]otlpSpan) error {
+	// collect resource and scope spans
+	service := otlpUnknownService
+	var scopes [][]byte
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			attrs, err := decodeOTLPResource(value)
+			if err != nil {
+				return err
+			}
+			if name := attrs["service.name"]; name != "" {
+				service = name
+			}
+		case 2:
+			scopes = append(scopes, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// decode scope spans
+	for _, scope := range scopes {
+		err = walkProto(scope, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+			if num != 2 || typ != protowire.BytesType {
+				return nil
+			}
+			name, event, err := decodeOTLPSpan(value)
+			if err != nil {
+				return err
+			}
+			*spans = append(*spans, otlpSpan{
+				service: service,
+				name:    name,
+				event:   event,
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeOTLPResource(data []byte) (map[string]string, error) {
+	// decode attributes
+	attrs := map[string]string{}
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			return decodeOTLPKeyValue(value, attrs)
+		}
+		return nil
+	})
+
+	return attrs, err
+}
+
+func decodeOTLPSpan(data []byte) (string, traceEvent, error) {
+	// decode fields
+	var name string
+	var event traceEvent
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, value []byte, number uint64) error {
+		switch {
+		case num == 2 && typ == protowire.BytesType:
+			event.id = hex.EncodeToString(value)
+		case num == 4 && typ == protowire.BytesType:
+			event.parent = hex.EncodeToString(value)
+		case num == 5 && typ == protowire.BytesType:
+			name = string(value)
+		case num == 7 && typ == protowire.Fixed64Type:
+			event.start = time.Unix(0, int64(number))
+		case num == 8 && typ == protowire.Fixed64Type:
+			event.stop = time.Unix(0, int64(number))
+		case num == 9 && typ == protowire.BytesType:
+			if event.attrs == nil {
+				event.attrs = map[string]string{}
+			}
+			return decodeOTLPKeyValue(value, event.attrs)
+		case num == 11 && typ == protowire.BytesType:
+			mark, err := decodeOTLPEvent(value)
+			if err != nil {
+				return err
+			}
+			event.marks = append(event.marks, mark)
+		case num == 15 && typ == protowire.BytesType:
+			return walkProto(value, func(num protowire.Number, typ protowire.Type, value []byte, number uint64) error {
+				if num == 2 && typ == protowire.BytesType {
+					event.message = string(value)
+				} else if num == 3 && typ == protowire.VarintType {
+					event.failed = number == 2
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	return name, event, err
+}
+
+func decodeOTLPEvent(data []byte) (traceMark, error) {
+	// decode fields
+	var mark traceMark
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, value []byte, number uint64) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			mark.time = time.Unix(0, int64(number))
+		case num == 2 && typ == protowire.BytesType:
+			mark.name = string(value)
+		case num == 3 && typ == protowire.BytesType:
+			if mark.attrs == nil {
+				mark.attrs = map[string]string{}
+			}
+			return decodeOTLPKeyValue(value, mark.attrs)
+		}
+		return nil
+	})
+
+	return mark, err
+}
+
+func decodeOTLPKeyValue(data []byte, attrs map[string]string) error {
+	// decode key and value
+	var key, value string
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, raw []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			key = string(raw)
+		case 2:
+			var err error
+			value, err = decodeOTLPAnyValue(raw)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// set attribute
+	attrs[key] = value
+
+	return nil
+}
+
+func decodeOTLPAnyValue(data []byte) (string, error) {
+	// decode value
+	var value string
+	err := walkProto(data, func(num protowire.Number, typ protowire.Type, raw []byte, number uint64) error {
+		switch num {
+		case 1:
+			value = string(raw)
+		case 2:
+			value = strconv.FormatBool(number != 0)
+		case 3:
+			value = strconv.FormatInt(int64(number), 10)
+		case 4:
+			value = strconv.FormatFloat(math.Float64frombits(number), 'g', -1, 64)
+		case 5, 6:
+			// format arrays and key value lists
+			var items []string
+			err := walkProto(raw, func(_ protowire.Number, _ protowire.Type, raw []byte, _ uint64) error {
+				if num == 6 {
+					attrs := map[string]string{}
+					err := decodeOTLPKeyValue(raw, attrs)
+					for key, value := range attrs {
+						items = append(items, key+"="+value)
+					}
+					return err
+				}
+				item, err := decodeOTLPAnyValue(raw)
+				items = append(items, item)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			value = "[" + strings.Join(items, ", ") + "]"
+		case 7:
+			value = base64.StdEncoding.EncodeToString(raw)
+		}
+		return nil
+	})
+
+	return value, err
+}
+
+func walkProto(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, number uint64) error) error {
+	for len(data) > 0 {
+		// consume tag
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		// consume value
+		var value []byte
+		var number uint64
+		switch typ {
+		case protowire.VarintType:
+			number, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			number, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			number = uint64(v)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		// yield field
+		err := fn(num, typ, value, number)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type otlpJSONRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []otlpJSONSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type otlpJSONSpan struct {
+	SpanID       string             `json:"spanId"`
+	ParentSpanID string             `json:"parentSpanId"`
+	Name         string             `json:"name"`
+	Start        otlpJSONNanos      `json:"startTimeUnixNano"`
+	End          otlpJSONNanos      `json:"endTimeUnixNano"`
+	Attributes   []otlpJSONKeyValue `json:"attributes"`
+	Events       []struct {
+		Time       otlpJSONNanos      `json:"timeUnixNano"`
+		Name       string             `json:"name"`
+		Attributes []otlpJSONKeyValue `json:"attributes"`
+	} `json:"events"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONAnyValue struct {
+	StringValue *string          `json:"stringValue"`
+	BoolValue   *bool            `json:"boolValue"`
+	IntValue    *otlpJSONInt     `json:"intValue"`
+	DoubleValue *float64         `json:"doubleValue"`
+	BytesValue  *string          `json:"bytesValue"`
+	ArrayValue  *json.RawMessage `json:"arrayValue"`
+	KvlistValue *json.RawMessage `json:"kvlistValue"`
+}
+
+func (v otlpJSONAnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		return string(*v.ArrayValue)
+	case v.KvlistValue != nil:
+		return string(*v.KvlistValue)
+	default:
+		return ""
+	}
+}
+
+type otlpJSONNanos uint64
+
+func (n *otlpJSONNanos) UnmarshalJSON(data []byte) error {
+	// 64-bit integers may be encoded as strings
+	num, err := strconv.ParseUint(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer: %s", data)
+	}
+	*n = otlpJSONNanos(num)
+
+	return nil
+}
+
+type otlpJSONInt int64
+
+func (n *otlpJSONInt) UnmarshalJSON(data []byte) error {
+	// 64-bit integers may be encoded as strings
+	num, err := strconv.ParseInt(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer: %s", data)
+	}
+	*n = otlpJSONInt(num)
+
+	return nil
+}
+
+func decodeOTLPJSON(data []byte) ([]otlpSpan, error) {
+	// decode request
+	var req otlpJSONRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert spans
+	var spans []otlpSpan
+	for _, rs := range req.ResourceSpans {
+		// get service
+		service := otlpUnknownService
+		for _, kv := range rs.Resource.Attributes {
+			if kv.Key == "service.name" && kv.Value.String() != "" {
+				service = kv.Value.String()
+			}
+		}
+
+		// add spans
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				event := traceEvent{
+					id:      strings.ToLower(span.SpanID),
+					parent:  strings.ToLower(span.ParentSpanID),
+					start:   time.Unix(0, int64(span.Start)),
+					stop:    time.Unix(0, int64(span.End)),
+					attrs:   otlpJSONAttrs(span.Attributes),
+					failed:  span.Status.Code == 2,
+					message: span.Status.Message,
+				}
+				for _, e := range span.Events {
+					event.marks = append(event.marks, traceMark{
+						name:  e.Name,
+						time:  time.Unix(0, int64(e.Time)),
+						attrs: otlpJSONAttrs(e.Attributes),
+					})
+				}
+				spans = append(spans, otlpSpan{
+					service: service,
+					name:    span.Name,
+					event:   event,
+				})
+			}
+		}
+	}
+
+	return spans, nil
+}
+
+func otlpJSONAttrs(list []otlpJSONKeyValue) map[string]string {
+	// check list
+	if len(list) == 0 {
+		return nil
+	}
+
+	// convert attributes
+	attrs := make(map[string]string, len(list))
+	for _, kv := range list {
+		attrs[kv.Key] = kv.Value.String()
+	}
+
+	return attrs
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func protoBytes(b []byte, num protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+func protoVarint(b []byte, num protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func protoFixed64(b []byte, num protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, value)
+}
+
+func protoAttr(key string, value []byte) []byte {
+	return protoBytes(protoBytes(nil, 1, []byte(key)), 2, value)
+}
+
+func protoRequest(service string, spans ...[]byte) []byte {
+	// encode resource
+	var resource []byte
+	if service != "" {
+		resource = protoBytes(nil, 1, protoAttr("service.name", protoBytes(nil, 1, []byte(service))))
+	}
+
+	// encode scope spans
+	var scope []byte
+	for _, span := range spans {
+		scope = protoBytes(scope, 2, span)
+	}
+
+	// encode resource spans
+	var rs []byte
+	if resource != nil {
+		rs = protoBytes(rs, 1, resource)
+	}
+	rs = protoBytes(rs, 2, scope)
+
+	return protoBytes(nil, 1, rs)
+}
+
+func protoSpan(id, parent, name string, start, stop time.Time, extra ...[]byte) []byte {
+	// encode fields
+	span := protoBytes(nil, 1, bytes.Repeat([]byte{1}, 16))
+	span = protoBytes(span, 2, []byte(id))
+	if parent != "" {
+		span = protoBytes(span, 4, []byte(parent))
+	}
+	span = protoBytes(span, 5, []byte(name))
+	span = protoFixed64(span, 7, uint64(start.UnixNano()))
+	span = protoFixed64(span, 8, uint64(stop.UnixNano()))
+	for _, field := range extra {
+		span = append(span, field...)
+	}
+
+	return span
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	// compress data
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gz.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeOTLPProto(t *testing.T) {
+	start := time.Unix(0, 1700000000000000000)
+	stop := start.Add(200 * time.Millisecond)
+
+	// prepare attributes
+	negative := int64(-42)
+	attrs := protoBytes(nil, 9, protoAttr("http.method", protoBytes(nil, 1, []byte("GET"))))
+	attrs = protoBytes(attrs, 9, protoAttr("retries", protoVarint(nil, 3, uint64(negative))))
+	attrs = protoBytes(attrs, 9, protoAttr("ratio", protoFixed64(nil, 4, math.Float64bits(0.5))))
+	attrs = protoBytes(attrs, 9, protoAttr("cached", protoVarint(nil, 2, 1)))
+	attrs = protoBytes(attrs, 9, protoAttr("tags", protoBytes(nil, 5, append(
+		protoBytes(nil, 1, protoBytes(nil, 1, []byte("a"))),
+		protoBytes(nil, 1, protoVarint(nil, 3, 7))...,
+	))))
+
+	// prepare event and status
+	event := protoFixed64(nil, 1, uint64(start.Add(time.Millisecond).UnixNano()))
+	event = protoBytes(event, 2, []byte("retry"))
+	event = protoBytes(event, 3, protoAttr("attempt", protoVarint(nil, 3, 2)))
+	status := protoVarint(protoBytes(nil, 2, []byte("timeout")), 3, 2)
+
+	// prepare spans
+	parent := protoSpan("\x0a\x0b", "", "GET /users", start, stop, attrs)
+	child := protoSpan("\x0c\x0d", "\x0a\x0b", "db.query", start.Add(time.Millisecond), stop, protoBytes(nil, 11, event), protoBytes(nil, 15, status))
+
+	table := []struct {
+		name  string
+		data  []byte
+		spans []otlpSpan
+		err   bool
+	}{
+		{
+			name: "Empty",
+			data: nil,
+		},
+		{
+			name: "NestedSpans",
+			data: protoRequest("api", parent, child),
+			spans: []otlpSpan{
+				{
+					service: "api",
+					name:    "GET /users",
+					event: traceEvent{
+						id:    "0a0b",
+						start: start,
+						stop:  stop,
+						attrs: map[string]string{
+							"http.method": "GET",
+							"retries":     "-42",
+							"ratio":       "0.5",
+							"cached":      "true",
+							"tags":        "[a, 7]",
+						},
+					},
+				},
+				{
+					service: "api",
+					name:    "db.query",
+					event: traceEvent{
+						id:      "0c0d",
+						parent:  "0a0b",
+						start:   start.Add(time.Millisecond),
+						stop:    stop,
+						failed:  true,
+						message: "timeout",
+						marks: []traceMark{
+							{
+								name:  "retry",
+								time:  start.Add(time.Millisecond),
+								attrs: map[string]string{"attempt": "2"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "UnknownService",
+			data: protoRequest("", protoSpan("\x01", "", "work", start, stop)),
+			spans: []otlpSpan{
+				{
+					service: otlpUnknownService,
+					name:    "work",
+					event: traceEvent{
+						id:    "01",
+						start: start,
+						stop:  stop,
+					},
+				},
+			},
+		},
+		{
+			name: "Truncated",
+			data: protoRequest("api", parent)[:20],
+			err:  true,
+		},
+	}
+
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			spans, err := decodeOTLPProto(item.data)
+			if item.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(spans, item.spans) {
+				t.Fatalf("got %+v, want %+v", spans, item.spans)
+			}
+		})
+	}
+}
+
+func TestDecodeOTLPJSON(t *testing.T) {
+	start := time.Unix(0, 1700000000000000000)
+	stop := start.Add(200 * time.Millisecond)
+
+	table := []struct {
+		name  string
+		data  string
+		spans []otlpSpan
+		err   bool
+	}{
+		{
+			name: "Empty",
+			data: `{}`,
+		},
+		{
+			name: "NestedSpans",
+			data: `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},"scopeSpans":[{"spans":[
+				{"spanId":"0A0B","name":"GET /users","startTimeUnixNano":"1700000000000000000","endTimeUnixNano":"1700000000200000000",
+				 "attributes":[{"key":"retries","value":{"intValue":"-42"}},{"key":"offset","value":{"intValue":-7}},{"key":"cached","value":{"boolValue":true}}]},
+				{"spanId":"0c0d","parentSpanId":"0a0b","name":"db.query","startTimeUnixNano":1700000000001000000,"endTimeUnixNano":"1700000000200000000",
+				 "events":[{"timeUnixNano":"1700000000001000000","name":"retry","attributes":[{"key":"attempt","value":{"intValue":"2"}}]}],
+				 "status":{"code":2,"message":"timeout"}}
+			]}]}]}`,
+			spans: []otlpSpan{
+				{
+					service: "api",
+					name:    "GET /users",
+					event: traceEvent{
+						id:    "0a0b",
+						start: start,
+						stop:  stop,
+						attrs: map[string]string{
+							"retries": "-42",
+							"offset":  "-7",
+							"cached":  "true",
+						},
+					},
+				},
+				{
+					service: "api",
+					name:    "db.query",
+					event: traceEvent{
+						id:      "0c0d",
+						parent:  "0a0b",
+						start:   start.Add(time.Millisecond),
+						stop:    stop,
+						failed:  true,
+						message: "timeout",
+						marks: []traceMark{
+							{
+								name:  "retry",
+								time:  start.Add(time.Millisecond),
+								attrs: map[string]string{"attempt": "2"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "UnknownService",
+			data: `{"resourceSpans":[{"scopeSpans":[{"spans":[{"spanId":"01","name":"work","startTimeUnixNano":"1700000000000000000","endTimeUnixNano":"1700000000200000000"}]}]}]}`,
+			spans: []otlpSpan{
+				{
+					service: otlpUnknownService,
+					name:    "work",
+					event: traceEvent{
+						id:    "01",
+						start: start,
+						stop:  stop,
+					},
+				},
+			},
+		},
+		{
+			name: "InvalidInteger",
+			data: `{"resourceSpans":[{"scopeSpans":[{"spans":[{"name":"work","attributes":[{"key":"n","value":{"intValue":"x"}}]}]}]}]}`,
+			err:  true,
+		},
+		{
+			name: "NegativeTime",
+			data: `{"resourceSpans":[{"scopeSpans":[{"spans":[{"name":"work","startTimeUnixNano":"-1"}]}]}]}`,
+			err:  true,
+		},
+	}
+
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			spans, err := decodeOTLPJSON([]byte(item.data))
+			if item.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(spans, item.spans) {
+				t.Fatalf("got %+v, want %+v", spans, item.spans)
+			}
+		})
+	}
+}
+
+func TestReceiveOTLP(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	stop := start.Add(100 * time.Millisecond)
+
+	// prepare payloads
+	proto := protoRequest("otlp-proto", protoSpan("\x01", "", "work", start, stop))
+	jsonBody := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"otlp-json"}}]},"scopeSpans":[{"spans":[
+		{"spanId":"01","name":"work","startTimeUnixNano":"` + strconv.FormatInt(start.UnixNano(), 10) + `","endTimeUnixNano":"` + strconv.FormatInt(stop.UnixNano(), 10) + `",
+		 "attributes":[{"key":"n","value":{"intValue":"-1"}}]}]}]}]}`
+
+	table := []struct {
+		name        string
+		method      string
+		contentType string
+		encoding    string
+		body        []byte
+		status      int
+		stream      string
+	}{
+		{
+			name:        "Proto",
+			contentType: "application/x-protobuf",
+			body:        proto,
+			status:      http.StatusOK,
+			stream:      "otlp-proto",
+		},
+		{
+			name:        "ProtoGzip",
+			contentType: "application/x-protobuf",
+			encoding:    "gzip",
+			body:        gzipData(t, proto),
+			status:      http.StatusOK,
+			stream:      "otlp-proto",
+		},
+		{
+			name:        "JSON",
+			contentType: "application/json; charset=utf-8",
+			body:        []byte(jsonBody),
+			status:      http.StatusOK,
+			stream:      "otlp-json",
+		},
+		{
+			name:        "JSONGzip",
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        gzipData(t, []byte(jsonBody)),
+			status:      http.StatusOK,
+			stream:      "otlp-json",
+		},
+		{
+			name:   "Method",
+			method: "GET",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "ContentType",
+			contentType: "text/plain",
+			body:        []byte("foo"),
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "InvalidGzip",
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        []byte("foo"),
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "InvalidProto",
+			contentType: "application/x-protobuf",
+			body:        proto[:10],
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "DecompressedTooLarge",
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        gzipData(t, []byte(strings.Repeat(" ", otlpMaxBody+1))),
+			status:      http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, item := range table {
+		t.Run(item.name, func(t *testing.T) {
+			// reset streams
+			resetTraces()
+
+			// send request
+			req := httptest.NewRequest(lo.Ternary(item.method != "", item.method, "POST"), "/v1/traces", bytes.NewReader(item.body))
+			req.Header.Set("Content-Type", item.contentType)
+			if item.encoding != "" {
+				req.Header.Set("Content-Encoding", item.encoding)
+			}
+			rec := httptest.NewRecorder()
+			receiveOTLP(rec, req)
+			if rec.Code != item.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, item.status, rec.Body.String())
+			}
+
+			// check stream
+			if item.stream != "" {
+				traceMutex.Lock()
+				stream := traceStreams[item.stream]
+				traceMutex.Unlock()
+				if stream == nil || stream.tasks["work"] == nil || stream.tasks["work"].size != 1 {
+					t.Fatalf("missing event in stream %q", item.stream)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const traceRingMinSize = 16
+
+type traceRing struct {
+	buf  []traceEvent
+	head int
+	size int
+}
+
+func (r *traceRing) at(i int) *traceEvent {
+	return &r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *traceRing) oldest() *traceEvent {
+	// check size
+	if r.size == 0 {
+		return nil
+	}
+
+	return &r.buf[r.head]
+}
+
+func (r *traceRing) push(event traceEvent) {
+	// grow buffer
+	if r.size == len(r.buf) {
+		r.resize(max(traceRingMinSize, len(r.buf)*2))
+	}
+
+	// insert event, keeping events ordered by stop time
+	i := r.size
+	for i > 0 && r.at(i-1).stop.After(event.stop) {
+		*r.at(i) = *r.at(i - 1)
+		i--
+	}
+	*r.at(i) = event
+	r.size++
+}
+
+func (r *traceRing) pop() {
+	// clear and release event
+	r.buf[r.head] = traceEvent{}
+	r.head = (r.head + 1) % len(r.buf)
+	r.size--
+}
+
+func (r *traceRing) prune(cutoff time.Time) int {
+	// remove events that stopped before the cutoff
+	var n int
+	for r.size > 0 && !r.oldest().stop.After(cutoff) {
+		r.pop()
+		n++
+	}
+
+	// shrink buffer
+	if len(r.buf) > traceRingMinSize && r.size < len(r.buf)/4 {
+		r.resize(max(traceRingMinSize, len(r.buf)/2))
+	}
+
+	return n
+}
+
+func (r *traceRing) resize(size int) {
+	// copy events
+	buf := make([]traceEvent, size)
+	for i := 0; i < r.size; i++ {
+		buf[i] = *r.at(i)
+	}
+
+	// set buffer
+	r.buf = buf
+	r.head = 0
+}
+
+func (r *traceRing) collect(start, end time.Time, events []traceEvent) []traceEvent {
+	// find first event that stopped after the start
+	first := sort.Search(r.size, func(i int) bool {
+		return !r.at(i).stop.Before(start)
+	})
+
+	// collect events that started before the end
+	for i := first; i < r.size; i++ {
+		if event := r.at(i); !event.start.After(end) {
+			events = append(events, *event)
+		}
+	}
+
+	return events
+}
+
+type traceRingHeap []*traceRing
+
+func (h traceRingHeap) Len() int {
+	return len(h)
+}
+
+func (h traceRingHeap) Less(i, j int) bool {
+	return h[i].oldest().stop.Before(h[j].oldest().stop)
+}
+
+func (h traceRingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *traceRingHeap) Push(x any) {
+	*h = append(*h, x.(*traceRing))
+}
+
+func (h *traceRingHeap) Pop() any {
+	old := *h
+	ring := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return ring
+}
@@ -2,11 +2,65 @@ package main
 
 import "time"
 
+type traceMark struct {
+	name  string
+	time  time.Time
+	attrs map[string]string
+}
+
 type traceEvent struct {
-	start time.Time
-	stop  time.Time
+	start   time.Time
+	stop    time.Time
+	id      string
+	parent  string
+	label   string
+	attrs   map[string]string
+	failed  bool
+	message string
+	marks   []traceMark
 }
 
 type traceStream struct {
-	events map[string][]traceEvent
+	tasks map[string]*traceRing
+}
+
+func (s *traceStream) collect(start, end time.Time) map[string][]traceEvent {
+	// check stream, streams are removed once all their events expired
+	if s == nil {
+		return nil
+	}
+
+	// collect events
+	events := make(map[string][]traceEvent, len(s.tasks))
+	for task, ring := range s.tasks {
+		events[task] = ring.collect(start, end, nil)
+	}
+
+	return events
+}
+
+func traceDepths(events []traceEvent) []int {
+	// index spans
+	index := make(map[string]int, len(events))
+	for i, event := range events {
+		if event.id != "" {
+			index[event.id] = i
+		}
+	}
+
+	// compute depths by walking parents, guarding against cycles
+	depths := make([]int, len(events))
+	for i, event := range events {
+		parent := event.parent
+		for parent != "" && depths[i] < len(events) {
+			j, ok := index[parent]
+			if !ok {
+				break
+			}
+			depths[i]++
+			parent = events[j].parent
+		}
+	}
+
+	return depths
 }
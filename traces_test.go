@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func resetTraces() {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	// reset state
+	traceStreams = map[string]*traceStream{}
+	traceCount = 0
+	tracePruned = time.Time{}
+	traceInvalid = 0
+	traceInvalidReported = time.Time{}
+	traceDurations = map[traceMetricKey][]time.Duration{}
+	traceActivity = map[traceMetricKey]time.Time{}
+}
+
+func fillTraces(rings, events int, now time.Time) {
+	for i := 0; i < events; i++ {
+		for j := 0; j < rings; j++ {
+			stop := now.Add(time.Duration(i*rings+j) * time.Microsecond)
+			addTraceEvent("stream", "task"+strconv.Itoa(j), traceEvent{start: stop.Add(-time.Millisecond), stop: stop})
+		}
+	}
+}
+
+func TestEvictTraces(t *testing.T) {
+	resetTraces()
+	defer resetTraces()
+
+	// add events interleaved across rings
+	now := time.Now()
+	fillTraces(10, 100, now)
+
+	// evict
+	traceMutex.Lock()
+	evictTraces(500)
+	traceMutex.Unlock()
+
+	// check that the oldest events were removed
+	if traceCount != 500 {
+		t.Fatalf("got %d events, want 500", traceCount)
+	}
+	for task, ring := range traceStreams["stream"].tasks {
+		if ring.size != 50 {
+			t.Fatalf("%s: got %d events, want 50", task, ring.size)
+		}
+		if oldest := ring.oldest().stop; oldest.Before(now.Add(500 * time.Microsecond)) {
+			t.Fatalf("%s: kept old event %s", task, oldest.Sub(now))
+		}
+	}
+}
+
+func countTraceRings() int {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	// count rings
+	var n int
+	for _, stream := range traceStreams {
+		n += len(stream.tasks)
+	}
+
+	return n
+}
+
+func TestTraceRingRemoval(t *testing.T) {
+	resetTraces()
+	defer resetTraces()
+
+	// add expired events, each ring is emptied but kept until the sweep
+	fillTraces(10, 5, time.Now().Add(-2**traceLength))
+	if n := countTraceRings(); n != 10 {
+		t.Fatalf("got %d rings, want 10", n)
+	}
+
+	// trigger sweep with a live event
+	traceMutex.Lock()
+	tracePruned = time.Time{}
+	traceMutex.Unlock()
+	now := time.Now()
+	addTraceEvent("live", "task", traceEvent{start: now.Add(-time.Millisecond), stop: now})
+	if n := countTraceRings(); n != 1 || traceStreams["stream"] != nil {
+		t.Fatalf("got %d rings, want 1", n)
+	}
+
+	// evict all events
+	fillTraces(10, 10, now)
+	traceMutex.Lock()
+	evictTraces(0)
+	traceMutex.Unlock()
+	if n := countTraceRings(); n != 0 || len(traceStreams) != 0 || traceCount != 0 {
+		t.Fatalf("got %d rings, %d streams and %d events", n, len(traceStreams), traceCount)
+	}
+}
+
+func TestTraceMetricsExpiry(t *testing.T) {
+	resetTraces()
+	defer resetTraces()
+	defer func() {
+		metricsTree = metricsNode{name: "root"}
+	}()
+
+	// derive metrics for a call
+	now := time.Now()
+	addTraceEvent("api", "GET", traceEvent{start: now.Add(-time.Millisecond), stop: now})
+	deriveTraceMetrics(now.Add(-time.Second), now)
+	if metricsTree.child("trace").child("api").child("GET").child("rate") == nil {
+		t.Fatal("missing rate")
+	}
+
+	// derive metrics once the key has been idle for the retention window
+	later := now.Add(2 * *traceLength)
+	deriveTraceMetrics(later.Add(-time.Second), later)
+	if metricsTree.child("trace") != nil {
+		t.Fatal("expired metrics were kept")
+	}
+}
+
+func BenchmarkTraceIngest(b *testing.B) {
+	resetTraces()
+	defer resetTraces()
+
+	// prepare names
+	var streams, tasks []string
+	for i := 0; i < 4; i++ {
+		streams = append(streams, "stream"+strconv.Itoa(i))
+	}
+	for i := 0; i < 250; i++ {
+		tasks = append(tasks, "task"+strconv.Itoa(i))
+	}
+
+	// add events beyond the limit to include eviction
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stop := now.Add(time.Duration(i) * time.Microsecond)
+		addTraceEvent(streams[i%len(streams)], tasks[i%len(tasks)], traceEvent{start: stop.Add(-time.Millisecond), stop: stop})
+	}
+}
+
+func BenchmarkEvict(b *testing.B) {
+	resetTraces()
+	defer resetTraces()
+
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// fill 1000 rings with 100k events
+		b.StopTimer()
+		resetTraces()
+		fillTraces(1000, 100, now)
+		b.StartTimer()
+
+		// evict 90% of the events
+		traceMutex.Lock()
+		evictTraces(10000)
+		traceMutex.Unlock()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const traceLineLimit = 1 << 20
+
+func scanTraceLines(r io.Reader, handle func(string)) error {
+	// prepare scanner
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), traceLineLimit)
+
+	// scan lines
+	for scanner.Scan() {
+		handle(scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+func scanTraceEvents(r io.Reader, handle func(string)) error {
+	// prepare scanner
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), traceLineLimit)
+
+	// scan lines, the data of an event may contain multiple trace lines
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// dispatch event on empty line
+		if line == "" {
+			for _, item := range data {
+				handle(item)
+			}
+			data = data[:0]
+			continue
+		}
+
+		// collect data and ignore other fields and comments
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+
+	return scanner.Err()
+}
+
+func streamTraceSocket(url string, handle func(string)) (bool, error) {
+	// connect
+	conn, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return false, errTraceNotFound
+	} else if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// set status
+	setTraceStatus("Connected (WebSocket)")
+
+	// read messages, a message may contain multiple trace lines
+	for {
+		_, msg, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+			return true, nil
+		} else if err != nil {
+			return true, err
+		}
+		for _, line := range strings.Split(string(msg), "\n") {
+			handle(line)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func traceLine(task string) string {
+	// format event that stopped just now
+	stop := time.Now()
+	start := stop.Add(-time.Millisecond)
+
+	return fmt.Sprintf(`{"v":1,"stream":"test","task":%q,"start":%q,"stop":%q}`, task, start.Format(time.RFC3339Nano), stop.Format(time.RFC3339Nano))
+}
+
+func traceTasks() []string {
+	// acquire mutex
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	// collect tasks
+	var tasks []string
+	if stream := traceStreams["test"]; stream != nil {
+		for task, ring := range stream.tasks {
+			for i := 0; i < ring.size; i++ {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+
+	return tasks
+}
+
+func TestLoadTracesSSE(t *testing.T) {
+	resetTraces()
+	defer resetTraces()
+
+	// serve one event per connection, the second one carries two lines
+	var conns atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := conns.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprintf(w, ": keep alive\n\nevent: trace\ndata: %s\n\n", traceLine(fmt.Sprint("a", n)))
+		if n == 2 {
+			_, _ = fmt.Fprintf(w, "data: %s\ndata: %s\n\n", traceLine("b1"), traceLine("b2"))
+		}
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	// connect and get disconnected by the server
+	var refreshed int
+	connected, err := loadTraces(server.URL, func() {
+		refreshed++
+	})
+	if !connected || err != nil {
+		t.Fatalf("got %v, %v", connected, err)
+	}
+	if tasks := traceTasks(); len(tasks) != 1 || tasks[0] != "a1" {
+		t.Fatalf("got %v", tasks)
+	}
+
+	// reconnect
+	connected, err = loadTraces(server.URL, func() {
+		refreshed++
+	})
+	if !connected || err != nil {
+		t.Fatalf("got %v, %v", connected, err)
+	}
+	if tasks := traceTasks(); len(tasks) != 4 {
+		t.Fatalf("got %v", tasks)
+	}
+	if refreshed != 4 {
+		t.Fatalf("got %d refreshes", refreshed)
+	}
+	if status := getTraceStatus(); status != "Connected (SSE)" {
+		t.Fatalf("got status %q", status)
+	}
+}
+
+func TestLoadTracesLines(t *testing.T) {
+	resetTraces()
+	defer resetTraces()
+
+	// serve newline delimited events with invalid lines
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = fmt.Fprintf(w, "%s\n\ninvalid\n{\n%s\n", traceLine("a"), traceLine("b"))
+	}))
+	defer server.Close()
+
+	// connect
+	connected, err := loadTraces(server.URL, func() {})
+	if !connected || err != nil {
+		t.Fatalf("got %v, %v", connected, err)
+	}
+	if tasks := traceTasks(); len(tasks) != 2 {
+		t.Fatalf("got %v", tasks)
+	}
+	if invalid := getTraceInvalid(); invalid != 2 {
+		t.Fatalf("got %d invalid lines", invalid)
+	}
+}
+
+func TestLoadTracesWebSocket(t *testing.T) {
+	resetTraces()
+	defer resetTraces()
+
+	// close the first connection normally and drop the second one
+	var conns atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := conns.Add(1)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(traceLine(fmt.Sprint("a", n))))
+		if n == 1 {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(traceLine("b1")+"\n"+traceLine("b2")))
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			_, _, _ = conn.ReadMessage()
+		}
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// connect and get closed by the server
+	connected, err := loadTraces(url, func() {})
+	if !connected || err != nil {
+		t.Fatalf("got %v, %v", connected, err)
+	}
+	if tasks := traceTasks(); len(tasks) != 3 {
+		t.Fatalf("got %v", tasks)
+	}
+	if status := getTraceStatus(); status != "Connected (WebSocket)" {
+		t.Fatalf("got status %q", status)
+	}
+
+	// reconnect and get dropped by the server
+	connected, err = loadTraces(url, func() {})
+	if !connected || err == nil {
+		t.Fatalf("got %v, %v", connected, err)
+	}
+	if tasks := traceTasks(); len(tasks) != 4 {
+		t.Fatalf("got %v", tasks)
+	}
+}
+
+func TestLoadTracesNotFound(t *testing.T) {
+	// serve nothing
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// check both transports
+	for _, url := range []string{server.URL, "ws" + strings.TrimPrefix(server.URL, "http")} {
+		connected, err := loadTraces(url, func() {})
+		if connected || !errors.Is(err, errTraceNotFound) {
+			t.Fatalf("%s: got %v, %v", url, connected, err)
+		}
+	}
+}
@@ -2,69 +2,285 @@ package main
 
 import (
 	"image"
+	"image/color"
+	"math"
 	"sort"
 	"time"
 
 	"github.com/AllenDang/giu"
+	"github.com/AllenDang/imgui-go"
 	"github.com/samber/lo"
 )
 
+const traceMinSpan = time.Millisecond
+
+const traceDragThreshold = 4
+
 type traceWindow struct {
-	name string
-	open bool
+	name     string
+	open     bool
+	paused   bool
+	frozen   map[string][]traceEvent
+	end      time.Time
+	span     time.Duration
+	drag     bool
+	dragX    float32
+	panning  bool
+	left     float32
+	top      float32
+	width    float32
+	inspect  bool
+	selected *traceSpan
+}
+
+func (w *traceWindow) pause() {
+	// check state
+	if w.paused {
+		return
+	}
+
+	// freeze events
+	traceMutex.Lock()
+	w.frozen = traceStreams[w.name].collect(time.Time{}, time.Now())
+	traceMutex.Unlock()
+
+	// freeze range
+	w.paused = true
+	w.end = time.Now()
+}
+
+func (w *traceWindow) resume() {
+	w.paused = false
+	w.frozen = nil
+}
+
+func (w *traceWindow) visible() (time.Time, time.Duration) {
+	// get span
+	span := w.span
+	if span <= 0 || span > *traceLength {
+		span = *traceLength
+	}
+
+	// get end
+	end := time.Now()
+	if w.paused {
+		end = w.end
+	}
+
+	return end.Add(-span), span
+}
+
+func (w *traceWindow) events(start, end time.Time) map[string][]traceEvent {
+	// get live events
+	if !w.paused {
+		traceMutex.Lock()
+		defer traceMutex.Unlock()
+		return traceStreams[w.name].collect(start, end)
+	}
+
+	// get visible frozen events
+	events := make(map[string][]traceEvent, len(w.frozen))
+	for task, list := range w.frozen {
+		events[task] = lo.Filter(list, func(event traceEvent, _ int) bool {
+			return !event.stop.Before(start) && !event.start.After(end)
+		})
+	}
+
+	return events
 }
 
 func (w *traceWindow) draw(m *giu.MasterWindow) {
 	// create window
-	win := newWindow(m, w.name).IsOpen(&w.open)
+	win := newWindow(m, w.name, giu.WindowFlagsMenuBar).IsOpen(&w.open)
+
+	// get visible range
+	start, span := w.visible()
+
+	// get events
+	events := w.events(start, start.Add(span))
 
 	// compute keys
-	traceMutex.Lock()
-	keys := lo.Keys(traceStreams[w.name].events)
-	traceMutex.Unlock()
+	keys := lo.Keys(events)
 	sort.Strings(keys)
 
 	// collect rows
-	var rows []*giu.TableRowWidget
+	rows := []*giu.TableRowWidget{
+		giu.TableRow(giu.Label(""), giu.Custom(func() {
+			w.drawRuler(start, span)
+		})),
+	}
 	for _, task := range keys {
 		task := task
 		rows = append(rows, giu.TableRow(giu.Label(task), giu.Custom(func() {
 			// get positions
 			width, _ := giu.GetAvailableRegion()
-			ratio := float64(width) / float64(traceLength.Nanoseconds())
-			stop := float64(time.Now().UnixNano())
-			start := stop - float64(traceLength.Nanoseconds())
+			ratio := float64(width) / float64(span)
 			pos := giu.GetCursorPos()
 
-			// get events
-			traceMutex.Lock()
-			events := traceStreams[w.name].events[task]
-			traceMutex.Unlock()
+			// get depths
+			events := events[task]
+			depths := traceDepths(events)
 
 			// draw events
-			for _, event := range events {
+			for i, event := range events {
 				// calculate stop and start
-				eventStop := (float64(event.stop.UnixNano()) - start) * ratio
+				eventStop := float64(event.stop.Sub(start)) * ratio
 				if eventStop < 0 {
 					continue
 				}
-				eventStart := (float64(event.start.UnixNano()) - start) * ratio
-				if eventStart < 0 {
-					eventStart = 0
+				eventStart := float64(event.start.Sub(start)) * ratio
+				if eventStart > float64(width) {
+					continue
+				}
+				eventStart = math.Max(eventStart, 0)
+				eventStop = math.Min(eventStop, float64(width))
+
+				// highlight selection and errors
+				current := &traceSpan{task: task, event: event}
+				selected := current.same(w.selected)
+				if selected {
+					giu.PushStyleColor(giu.StyleColorPlotHistogram, color.RGBA{R: 230, G: 140, B: 40, A: 255})
+				} else if event.failed {
+					giu.PushStyleColor(giu.StyleColorPlotHistogram, color.RGBA{R: 210, G: 60, B: 60, A: 255})
 				}
 
-				// draw progress bar
-				giu.SetCursorPos(image.Pt(pos.X+int(eventStart), pos.Y))
-				giu.ProgressBar(1).Size(float32(eventStop-eventStart), 20).Build()
+				// draw progress bar, nested spans are stacked below their parents
+				giu.SetCursorPos(image.Pt(pos.X+int(eventStart), pos.Y+depths[i]*22))
+				giu.ProgressBar(1).Size(float32(max(eventStop-eventStart, 1)), 20).Overlay(event.label).Build()
+				if selected || event.failed {
+					giu.PopStyleColor()
+				}
+
+				// show details and select on click
+				if giu.IsItemHovered() {
+					giu.Tooltip(current.describe()).Build()
+				}
+				if giu.IsItemClicked(giu.MouseButtonLeft) {
+					w.selected = current
+					w.inspect = true
+				}
 			}
 		})))
 	}
 
 	// draw
 	win.Layout(
-		giu.Table().Columns(
-			giu.TableColumn("Task").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(200),
-			giu.TableColumn("Calls").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
-		).Rows(rows...),
+		giu.MenuBar().Layout(
+			giu.Condition(w.paused, giu.Layout{
+				giu.MenuItem("Resume").OnClick(w.resume),
+			}, giu.Layout{
+				giu.MenuItem("Pause").OnClick(w.pause),
+			}),
+			giu.MenuItem("Reset Zoom").Enabled(w.span > 0).OnClick(func() {
+				w.span = 0
+			}),
+			giu.Checkbox("Inspector", &w.inspect),
+			giu.Labelf("Showing %s of %s", span, *traceLength),
+		),
+		giu.Row(
+			giu.Child().Size(lo.Ternary[float32](w.inspect, -360, 0), 0).Layout(
+				giu.Table().Columns(
+					giu.TableColumn("Task").Flags(giu.TableColumnFlagsWidthFixed).InnerWidthOrWeight(200),
+					giu.TableColumn("Calls").Flags(giu.TableColumnFlagsWidthStretch).InnerWidthOrWeight(1),
+				).Rows(rows...),
+			),
+			giu.Condition(w.inspect, giu.Layout{
+				giu.Child().Size(0, 0).Layout(giu.Custom(func() {
+					w.buildInspector(events, start, span).Build()
+				})),
+			}, nil),
+		),
+		giu.Custom(func() {
+			w.handleInput(start, span)
+		}),
 	)
 }
+
+func (w *traceWindow) drawRuler(start time.Time, span time.Duration) {
+	// get positions
+	width, _ := giu.GetAvailableRegion()
+	pos := giu.GetCursorScreenPos()
+	canvas := giu.GetCanvas()
+
+	// remember timeline area
+	w.left = float32(pos.X)
+	w.top = float32(pos.Y)
+	w.width = width
+
+	// get step
+	step := traceStep(span, width)
+
+	// draw ticks relative to the end of the range
+	col := color.RGBA{R: 150, G: 150, B: 150, A: 255}
+	for offset := time.Duration(0); offset <= span; offset += step {
+		x := pos.X + int(float64(span-offset)/float64(span)*float64(width))
+		canvas.AddLine(image.Pt(x, pos.Y+12), image.Pt(x, pos.Y+20), col, 1)
+		label := "-" + offset.String()
+		if offset == 0 {
+			label = lo.Ternary(w.paused, "paused", "now")
+		}
+		textWidth, _ := giu.CalcTextSize(label)
+		canvas.AddText(image.Pt(x-int(textWidth)-2, pos.Y), col, label)
+	}
+
+	// reserve space
+	giu.Dummy(width, 20).Build()
+}
+
+func (w *traceWindow) handleInput(start time.Time, span time.Duration) {
+	// check hover
+	mouse := giu.GetMousePos()
+	inside := w.width > 0 && float32(mouse.X) >= w.left && float32(mouse.X) <= w.left+w.width && float32(mouse.Y) >= w.top
+	hovered := inside && giu.IsWindowHovered(giu.HoveredFlagsChildWindows)
+
+	// get mouse position in range
+	ratio := float64(float32(mouse.X)-w.left) / float64(w.width)
+
+	// zoom around the mouse with the wheel
+	if wheel := imgui.CurrentIO().GetMouseWheelDelta(); hovered && wheel != 0 {
+		// get new span
+		newSpan := time.Duration(float64(span) * math.Pow(0.8, float64(wheel)))
+		newSpan = min(max(newSpan, traceMinSpan), *traceLength)
+
+		// keep the time under the mouse in place when paused
+		if w.paused {
+			at := start.Add(time.Duration(ratio * float64(span)))
+			w.end = at.Add(time.Duration((1 - ratio) * float64(newSpan)))
+		}
+		w.span = newSpan
+	}
+
+	// start dragging
+	if hovered && giu.IsMouseClicked(giu.MouseButtonLeft) {
+		w.drag = true
+		w.dragX = float32(mouse.X)
+		w.panning = false
+	}
+
+	// pan while dragging, small movements are treated as clicks
+	if w.drag {
+		if !giu.IsMouseDown(giu.MouseButtonLeft) {
+			w.drag = false
+		} else if moved := float32(mouse.X) - w.dragX; !w.panning && math.Abs(float64(moved)) >= traceDragThreshold {
+			w.panning = true
+			w.pause()
+			w.end = w.end.Add(-time.Duration(float64(moved) / float64(w.width) * float64(span)))
+		} else if delta := imgui.CurrentIO().GetMouseDelta().X; w.panning && delta != 0 {
+			w.end = w.end.Add(-time.Duration(float64(delta) / float64(w.width) * float64(span)))
+		}
+	}
+}
+
+func traceStep(span time.Duration, width float32) time.Duration {
+	// find the smallest 1-2-5 step with at least 100 pixels between ticks
+	for step := time.Duration(1); ; step *= 10 {
+		for _, factor := range []time.Duration{1, 2, 5} {
+			if float64(step*factor)/float64(span)*float64(width) >= 100 {
+				return step * factor
+			}
+		}
+		if step > span {
+			return span
+		}
+	}
+}
@@ -3,11 +3,12 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/AllenDang/giu"
 )
 
-func newWindow(m *giu.MasterWindow, title string) *giu.WindowWidget {
+func newWindow(m *giu.MasterWindow, title string, flags giu.WindowFlags) *giu.WindowWidget {
 	// get size
 	mw, mh := m.GetSize()
 
@@ -16,6 +17,14 @@ func newWindow(m *giu.MasterWindow, title string) *giu.WindowWidget {
 	win.Pos(100, 100)
 	win.Size(float32(mw-200), float32(mh-200))
 
+	// apply pending placement for one frame, fixed windows are always placed
+	if p, ok := takePlacement(title); ok {
+		win.Pos(p.X, p.Y)
+		win.Size(p.Width, p.Height)
+		flags |= giu.WindowFlagsNoMove | giu.WindowFlagsNoResize
+	}
+	win.Flags(flags)
+
 	return win
 }
 
@@ -33,6 +42,17 @@ func fmtBytes(b int64) string {
 		float64(b)/float64(div), "kMGTPE"[exp])
 }
 
+func fmtValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).String()
+	case "bytes":
+		return fmtBytes(v)
+	default:
+		return strconv.FormatInt(v, 10)
+	}
+}
+
 func f2s(f float64) string {
 	return strconv.FormatFloat(f, 'f', -1, 64)
 }